@@ -38,7 +38,8 @@ func run(filePath string) error {
 
 	c := compiler.NewCompiler()
 	defer c.Destroy()
-	var opts []compiler.Option
+	// imports are resolved relative to the file
+	opts := []compiler.Option{compiler.Basename(filePath)}
 	//opts = append(opts, compiler.DeclareMalloc())
 	result, err := c.RunProgramSi(src, opts...)
 	if err != nil {
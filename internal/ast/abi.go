@@ -0,0 +1,514 @@
+package ast
+
+import (
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// Function signatures are lowered following the System V x86-64 C ABI, so that Si functions
+// can call and be called from C: aggregates of up to two eightbytes are passed in registers,
+// coerced to integer and floating point scalars, bigger ones are passed in memory.
+
+type abiKind int
+
+const (
+	// abiDirect is passed as its IR type
+	abiDirect abiKind = iota
+	// abiCoerce is passed as one or two scalars, one per eightbyte
+	abiCoerce
+	// abiMemory is passed as a pointer to a copy: byval for parameters, sret for the return value
+	abiMemory
+)
+
+type abiArg struct {
+	Kind   abiKind
+	IRType types.Type
+	Parts  []types.Type
+	Attrs  []ir.ParamAttribute
+}
+
+type abiSignature struct {
+	Ret    *abiArg // nil for void
+	Params []*abiArg
+	Sig    *types.FuncType
+}
+
+// eightbyte classes
+const (
+	classNone = iota
+	classInteger
+	classSSE
+)
+
+// abiLeaf is a scalar inside an aggregate.
+type abiLeaf struct {
+	Offset, Size int
+	Float        bool
+}
+
+// leaves flattens t, placed at offset, into its scalars.
+func (t *Type) leaves(offset int, out []abiLeaf) ([]abiLeaf, error) {
+	switch {
+	case t.IsArray():
+		size, _, err := t.Array().Type.Layout()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < t.Array().Len; i++ {
+			if out, err = t.Array().Type.leaves(offset+i*size, out); err != nil {
+				return nil, err
+			}
+		}
+
+		return out, nil
+	case t.IsStruct(), t.IsTuple():
+		pos := 0
+
+		for _, f := range t.fieldTypes() {
+			size, align, err := f.Layout()
+			if err != nil {
+				return nil, err
+			}
+
+			pos = alignTo(pos, align)
+			if out, err = f.leaves(offset+pos, out); err != nil {
+				return nil, err
+			}
+
+			pos += size
+		}
+
+		return out, nil
+	case t.IsUnion():
+		ut := t.Union()
+
+		if ut.Tagged {
+			tag := int(UnionTagType().BitSize / 8)
+			out = append(out, abiLeaf{Offset: offset, Size: tag})
+
+			_, align, err := ut.payloadLayout()
+			if err != nil {
+				return nil, err
+			}
+
+			offset += alignTo(tag, align)
+		}
+
+		var err error
+		for _, f := range ut.Fields {
+			if out, err = f.Type.leaves(offset, out); err != nil {
+				return nil, err
+			}
+		}
+
+		return out, nil
+	case t.IsInterface(), t.IsClosure():
+		// the data and vtable pointers, or the function and environment pointers
+		return append(out, abiLeaf{Offset: offset, Size: 8}, abiLeaf{Offset: offset + 8, Size: 8}), nil
+	}
+
+	size, _, err := t.Layout()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, abiLeaf{Offset: offset, Size: size, Float: t.IsFloat()}), nil
+}
+
+func isAggregate(t *Type) bool {
+	return t.IsStruct() || t.IsTuple() || t.IsUnion() || t.IsArray() || t.IsInterface() || t.IsClosure()
+}
+
+// classify lowers a parameter or return type, using up the registers it needs.
+func classify(t *Type, freeInt, freeSSE *int) (*abiArg, error) {
+	irType, err := t.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	arg := &abiArg{Kind: abiDirect, IRType: irType}
+
+	if !isAggregate(t) {
+		switch {
+		case t.IsBool(), t.IsUInt() && t.BasicSize() < 32:
+			arg.Attrs = []ir.ParamAttribute{enum.ParamAttrZeroExt}
+		case t.IsInt() && t.BasicSize() < 32:
+			arg.Attrs = []ir.ParamAttribute{enum.ParamAttrSignExt}
+		}
+
+		if t.IsFloat() {
+			*freeSSE--
+		} else {
+			*freeInt--
+		}
+
+		return arg, nil
+	}
+
+	size, align, err := t.Layout()
+	if err != nil {
+		return nil, err
+	}
+
+	if size == 0 {
+		return arg, nil
+	}
+
+	if size > 16 {
+		arg.Kind = abiMemory
+		arg.Attrs = []ir.ParamAttribute{ir.Align(max(align, 8))}
+
+		return arg, nil
+	}
+
+	leaves, err := t.leaves(0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	needInt, needSSE := 0, 0
+	parts := []types.Type{}
+
+	for lo := 0; lo < size; lo += 8 {
+		hi := min(lo+8, size)
+
+		class := classNone
+		double := false
+		upper := false
+
+		for _, l := range leaves {
+			if l.Offset+l.Size <= lo || l.Offset >= hi {
+				continue
+			}
+
+			if !l.Float {
+				class = classInteger
+			} else if class == classNone {
+				class = classSSE
+			}
+
+			double = double || (l.Float && l.Size == 8)
+			upper = upper || l.Offset >= lo+4
+		}
+
+		switch {
+		case class == classSSE && double:
+			parts = append(parts, types.Double)
+			needSSE++
+		case class == classSSE && upper:
+			parts = append(parts, types.NewVector(2, types.Float))
+			needSSE++
+		case class == classSSE:
+			parts = append(parts, types.Float)
+			needSSE++
+		default:
+			parts = append(parts, types.NewInt(uint64(hi-lo)*8))
+			needInt++
+		}
+	}
+
+	// an aggregate is either passed in registers as a whole, or in memory
+	if needInt > *freeInt || needSSE > *freeSSE {
+		arg.Kind = abiMemory
+		arg.Attrs = []ir.ParamAttribute{ir.Align(max(align, 8))}
+
+		return arg, nil
+	}
+
+	*freeInt -= needInt
+	*freeSSE -= needSSE
+
+	arg.Kind = abiCoerce
+	arg.Parts = parts
+
+	return arg, nil
+}
+
+// lowerSignature lowers a function signature to its IR signature.
+func lowerSignature(params []*Type, variadic bool, ret *Type) (*abiSignature, error) {
+	sig := &abiSignature{}
+	freeInt, freeSSE := 6, 8
+
+	var retType types.Type = types.Void
+	irParams := []types.Type{}
+
+	if !ret.IsVoid() {
+		// the return value has its own registers
+		retInt, retSSE := 2, 2
+
+		a, err := classify(ret, &retInt, &retSSE)
+		if err != nil {
+			return nil, err
+		}
+
+		sig.Ret = a
+
+		switch a.Kind {
+		case abiDirect:
+			retType = a.IRType
+		case abiCoerce:
+			retType = a.coerced()
+		case abiMemory:
+			// the caller passes the address of the result in the first integer register
+			freeInt--
+			irParams = append(irParams, types.NewPointer(a.IRType))
+		}
+	}
+
+	for _, p := range params {
+		a, err := classify(p, &freeInt, &freeSSE)
+		if err != nil {
+			return nil, err
+		}
+
+		sig.Params = append(sig.Params, a)
+
+		switch a.Kind {
+		case abiDirect:
+			irParams = append(irParams, a.IRType)
+		case abiCoerce:
+			irParams = append(irParams, a.Parts...)
+		case abiMemory:
+			irParams = append(irParams, types.NewPointer(a.IRType))
+		}
+	}
+
+	sig.Sig = types.NewFunc(retType, irParams...)
+	sig.Sig.Variadic = variadic
+
+	return sig, nil
+}
+
+// coerced is the type of a coerced value: a single scalar, or a pair of them.
+func (a *abiArg) coerced() types.Type {
+	if len(a.Parts) == 1 {
+		return a.Parts[0]
+	}
+
+	return types.NewStruct(a.Parts...)
+}
+
+// partPointers returns pointers to the eightbytes of the aggregate stored at ptr.
+func (a *abiArg) partPointers(bb *ir.Block, ptr value.Value) []value.Value {
+	if len(a.Parts) == 1 {
+		return []value.Value{bb.NewBitCast(ptr, types.NewPointer(a.Parts[0]))}
+	}
+
+	pair := a.coerced()
+	cast := bb.NewBitCast(ptr, types.NewPointer(pair))
+
+	ptrs := make([]value.Value, 0, len(a.Parts))
+	for i := range a.Parts {
+		ptrs = append(ptrs, bb.NewGetElementPtr(pair, cast, NewLLInt(32, 0), NewLLInt(32, i)))
+	}
+
+	return ptrs
+}
+
+// temporary allocates memory for an aggregate that is reinterpreted as eightbytes.
+func (a *abiArg) temporary(bb *ir.Block) *ir.InstAlloca {
+	ptr := bb.NewAlloca(a.IRType)
+	ptr.Align = 8
+
+	return ptr
+}
+
+// split stores an aggregate value and loads it back as its eightbytes.
+func (a *abiArg) split(bb *ir.Block, v value.Value) []value.Value {
+	ptr := a.temporary(bb)
+	bb.NewStore(v, ptr)
+
+	parts := []value.Value{}
+	for i, p := range a.partPointers(bb, ptr) {
+		parts = append(parts, bb.NewLoad(a.Parts[i], p))
+	}
+
+	return parts
+}
+
+// join stores the eightbytes of an aggregate and returns the memory holding it.
+func (a *abiArg) join(bb *ir.Block, parts []value.Value) *ir.InstAlloca {
+	ptr := a.temporary(bb)
+
+	for i, p := range a.partPointers(bb, ptr) {
+		bb.NewStore(parts[i], p)
+	}
+
+	return ptr
+}
+
+// lowerArgs converts evaluated arguments to the IR arguments of a call.
+// result is the memory for the return value, when it is returned in memory.
+func (s *abiSignature) lowerArgs(bb *ir.Block, args []value.Value, result value.Value) []value.Value {
+	lowered := []value.Value{}
+
+	if s.Ret != nil && s.Ret.Kind == abiMemory {
+		lowered = append(lowered, ir.NewArg(result, ir.SRet{Typ: s.Ret.IRType}))
+	}
+
+	for i, v := range args {
+		// variadic arguments are passed as they are
+		if i >= len(s.Params) {
+			lowered = append(lowered, v)
+			continue
+		}
+
+		a := s.Params[i]
+
+		switch a.Kind {
+		case abiDirect:
+			lowered = append(lowered, ir.NewArg(v, a.Attrs...))
+		case abiCoerce:
+			lowered = append(lowered, a.split(bb, v)...)
+		case abiMemory:
+			ptr := a.temporary(bb)
+			bb.NewStore(v, ptr)
+
+			attrs := append([]ir.ParamAttribute{ir.Byval{Typ: a.IRType}}, a.Attrs...)
+			lowered = append(lowered, ir.NewArg(ptr, attrs...))
+		}
+	}
+
+	return lowered
+}
+
+// emitCall calls callee with the evaluated arguments and returns the result, nil for void.
+func (s *abiSignature) emitCall(bb *ir.Block, callee value.Value, args []value.Value) value.Value {
+	if s.Ret != nil && s.Ret.Kind == abiMemory {
+		result := s.Ret.temporary(bb)
+		bb.NewCall(callee, s.lowerArgs(bb, args, result)...)
+
+		return bb.NewLoad(s.Ret.IRType, result)
+	}
+
+	call := bb.NewCall(callee, s.lowerArgs(bb, args, nil)...)
+
+	if s.Ret == nil {
+		return call
+	}
+
+	switch s.Ret.Kind {
+	case abiCoerce:
+		parts := []value.Value{call}
+		if len(s.Ret.Parts) == 2 {
+			parts = []value.Value{bb.NewExtractValue(call, 0), bb.NewExtractValue(call, 1)}
+		}
+
+		return bb.NewLoad(s.Ret.IRType, s.Ret.join(bb, parts))
+	default:
+		call.ReturnAttrs = s.Ret.returnAttrs()
+
+		return call
+	}
+}
+
+// returnAttrs extends a returned scalar like a parameter.
+func (a *abiArg) returnAttrs() []ir.ReturnAttribute {
+	var attrs []ir.ReturnAttribute
+
+	for _, attr := range a.Attrs {
+		switch attr {
+		case enum.ParamAttrZeroExt:
+			attrs = append(attrs, enum.ReturnAttrZeroExt)
+		case enum.ParamAttrSignExt:
+			attrs = append(attrs, enum.ReturnAttrSignExt)
+		}
+	}
+
+	return attrs
+}
+
+// declare sets the parameters of the IR function of f, in the order of the lowered signature.
+func (s *abiSignature) declare(f *Function) []*ir.Param {
+	params := []*ir.Param{}
+
+	if s.Ret != nil && s.Ret.Kind == abiMemory {
+		p := ir.NewParam("result", types.NewPointer(s.Ret.IRType))
+		p.Attrs = []ir.ParamAttribute{enum.ParamAttrNoAlias, ir.SRet{Typ: s.Ret.IRType}}
+		params = append(params, p)
+	}
+
+	for i, a := range s.Params {
+		name := f.Params[i].Ident
+
+		switch a.Kind {
+		case abiDirect:
+			p := ir.NewParam(name, a.IRType)
+			p.Attrs = a.Attrs
+			params = append(params, p)
+		case abiCoerce:
+			for j, part := range a.Parts {
+				params = append(params, ir.NewParam(name+".coerce"+string(rune('0'+j)), part))
+			}
+		case abiMemory:
+			p := ir.NewParam(name, types.NewPointer(a.IRType))
+			p.Attrs = append([]ir.ParamAttribute{ir.Byval{Typ: a.IRType}}, a.Attrs...)
+			params = append(params, p)
+		}
+	}
+
+	return params
+}
+
+// storeParams makes the parameters of f variables in memory.
+func (s *abiSignature) storeParams(f *Function) {
+	bb := f.BasicBlock()
+	params := f.Ptr.Params
+
+	if s.Ret != nil && s.Ret.Kind == abiMemory {
+		params = params[1:]
+	}
+
+	for i, a := range s.Params {
+		p := f.Params[i]
+
+		switch a.Kind {
+		case abiDirect:
+			ptr := bb.NewAlloca(a.IRType)
+			bb.NewStore(params[0], ptr)
+			p.Ptr = ptr
+			params = params[1:]
+		case abiCoerce:
+			parts := make([]value.Value, 0, len(a.Parts))
+			for _, ip := range params[:len(a.Parts)] {
+				parts = append(parts, ip)
+			}
+
+			p.Ptr = a.join(bb, parts)
+			params = params[len(a.Parts):]
+		case abiMemory:
+			// the caller passes a copy, which is the variable
+			p.Ptr = params[0]
+			params = params[1:]
+		}
+	}
+}
+
+// emitReturn returns v from f.
+func (s *abiSignature) emitReturn(f *Function, v value.Value) {
+	bb := f.BasicBlock()
+
+	switch {
+	case s.Ret == nil || s.Ret.Kind == abiDirect:
+		bb.NewRet(v)
+	case s.Ret.Kind == abiMemory:
+		bb.NewStore(v, f.Ptr.Params[0])
+		bb.NewRet(nil)
+	default:
+		parts := s.Ret.split(bb, v)
+		if len(parts) == 1 {
+			bb.NewRet(parts[0])
+			return
+		}
+
+		pair := s.Ret.coerced()
+		var agg value.Value = bb.NewInsertValue(constant.NewUndef(pair), parts[0], 0)
+		agg = bb.NewInsertValue(agg, parts[1], 1)
+
+		bb.NewRet(agg)
+	}
+}
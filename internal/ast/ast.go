@@ -9,15 +9,38 @@ import (
 // MODULE, FUNCTIONS
 
 type TypeDef struct {
-	Alias string
-	Type  *Type
+	Alias    string
+	Type     *Type
+	Exported bool
+
+	// TypeParams of a generic type, which is only used through its instances
+	TypeParams []string
+	// Instantiate transforms the type again, in a scope that binds its type parameters
+	Instantiate func(scope ScopeLike) *Type
+	// Bounds transforms the interfaces the type arguments must implement, nil for an unbounded parameter
+	Bounds    func(scope ScopeLike) []*Type
+	instances map[string]*TypeDef
 }
 
 type Global struct {
 	Variable *Variable
+	Expr     ExpressionLike
+	Exported bool
+
+	Scope ScopeLike
+	Pos   lexer.Position
+}
+
+// Import makes the exported functions, globals and types of another file visible in a module.
+type Import struct {
+	Path   string
+	Module *Module
+
+	Pos lexer.Position
 }
 
 type Module struct {
+	Imports   []*Import
 	Functions []*Function
 
 	ModuleTypeDefs []*TypeDef
@@ -28,6 +51,15 @@ type Module struct {
 	LastID       int
 	CurrentBlock *ir.Block
 
+	// instances of generic functions, waiting for their bodies to be generated
+	pending []*Function
+	// vtables of the types converted to interfaces, by type and interface
+	vtables map[string]*ir.Global
+
+	// root is the module being compiled when this one is imported,
+	// it owns the IR module and the generated IDs of the whole program
+	root *Module
+
 	Scope *Scope
 	Pos   lexer.Position
 }
@@ -39,10 +71,27 @@ type Function struct {
 	ReturnType  *Type
 	Body        []StatementLike
 	OnlyDeclare bool
+	Exported    bool
+	// Receiver is the type alias of a method
+	Receiver string
+
+	// TypeParams of a generic function, which is only generated for its instances
+	TypeParams []string
+	// Instantiate transforms the function again, in a scope that binds its type parameters
+	Instantiate func(scope ScopeLike) *Function
+	// Bounds transforms the interfaces the type arguments must implement, nil for an unbounded parameter
+	Bounds    func(scope ScopeLike) []*Type
+	instances map[string]*Function
 
 	Locals []*Variable
 
+	// innermost break/continue target is the last one
+	Loops []*LoopTarget
+
 	Ptr *ir.Func
+	abi *abiSignature
+	// env holds the captured variables of a lambda
+	env *environment
 
 	Scope *Scope
 	Pos   lexer.Position
@@ -63,9 +112,19 @@ type ExprStmt struct {
 }
 
 type DeclStmt struct {
-	Ident string
-	Type  *Type
-	Expr  ExpressionLike
+	Ident   string
+	Type    *Type
+	Expr    ExpressionLike
+	IsConst bool
+
+	Scope ScopeLike
+	Pos   lexer.Position
+}
+
+// DestructureStmt declares a variable for every element of a tuple, e.g. i64 q, i64 r = divmod(a, b);
+type DestructureStmt struct {
+	Vars []*Variable
+	Expr ExpressionLike
 
 	Scope ScopeLike
 	Pos   lexer.Position
@@ -74,6 +133,7 @@ type DeclStmt struct {
 type AssignStmt struct {
 	Type  *Type
 	Left  ExpressionLike
+	Op    string
 	Right ExpressionLike
 
 	Scope ScopeLike
@@ -88,11 +148,15 @@ type ReturnStmt struct {
 }
 
 type ContinueStmt struct {
+	Label string
+
 	Scope ScopeLike
 	Pos   lexer.Position
 }
 
 type BreakStmt struct {
+	Label string
+
 	Scope ScopeLike
 	Pos   lexer.Position
 }
@@ -116,6 +180,7 @@ type IfStmt struct {
 }
 
 type WhileStmt struct {
+	Label     string
 	Condition ExpressionLike
 	Body      []StatementLike
 
@@ -123,7 +188,17 @@ type WhileStmt struct {
 	Pos   lexer.Position
 }
 
+type DoWhileStmt struct {
+	Label     string
+	Body      []StatementLike
+	Condition ExpressionLike
+
+	Scope ScopeLike
+	Pos   lexer.Position
+}
+
 type ForStmt struct {
+	Label     string
 	Init      StatementLike
 	Condition ExpressionLike
 	Post      StatementLike
@@ -134,12 +209,47 @@ type ForStmt struct {
 	Pos   lexer.Position
 }
 
+type SwitchCase struct {
+	Value     ExpressionLike
+	IsDefault bool
+	Body      []StatementLike
+
+	Pos lexer.Position
+}
+
+type SwitchStmt struct {
+	Expr  ExpressionLike
+	Cases []*SwitchCase
+
+	Scope ScopeLike
+	Pos   lexer.Position
+}
+
+type MatchArm struct {
+	Variant   string
+	Binding   string
+	IsDefault bool
+	Body      *Block
+
+	Pos lexer.Position
+}
+
+type MatchStmt struct {
+	Expr ExpressionLike
+	Arms []*MatchArm
+
+	Scope ScopeLike
+	Pos   lexer.Position
+}
+
 // EXPRESSIONS
 
 type Value struct {
 	Type  *Type
 	Ptr   value.Value
 	Value value.Value
+	// Const is set if Ptr points to a constant or into one, e.g. an element of a constant array
+	Const bool
 }
 
 type ExpressionLike interface {
@@ -147,6 +257,13 @@ type ExpressionLike interface {
 	Value() (*Value, error)
 }
 
+// ContextualExpressionLike is implemented by expressions whose type depends on the type
+// expected by the context they are used in, e.g. NULL assigned to a pointer field.
+type ContextualExpressionLike interface {
+	ExpressionLike
+	ValueFor(expected *Type) (*Value, error)
+}
+
 type BinaryOp struct {
 	Left  ExpressionLike
 	Op    string
@@ -156,6 +273,15 @@ type BinaryOp struct {
 	Pos   lexer.Position
 }
 
+type ConditionalOp struct {
+	Condition ExpressionLike
+	Then      ExpressionLike
+	Else      ExpressionLike
+
+	Scope ScopeLike
+	Pos   lexer.Position
+}
+
 type UnaryOp struct {
 	Op        string
 	Expr      ExpressionLike
@@ -191,9 +317,34 @@ type CastingOp struct {
 	Pos   lexer.Position
 }
 
-type FnCallOp struct {
+type StructLiteralField struct {
 	Ident string
-	Args  []ExpressionLike
+	Expr  ExpressionLike
+
+	Pos lexer.Position
+}
+
+type StructLiteralOp struct {
+	Type   *Type
+	Fields []*StructLiteralField
+
+	Scope ScopeLike
+	Pos   lexer.Position
+}
+
+type ArrayLiteralOp struct {
+	Elems []ExpressionLike
+
+	Scope ScopeLike
+	Pos   lexer.Position
+}
+
+type FnCallOp struct {
+	Ident    string
+	TypeArgs []*Type
+	// Expr is the callee when it is not a plain identifier, e.g. s->fn(x)
+	Expr ExpressionLike
+	Args []ExpressionLike
 
 	Scope ScopeLike
 	Pos   lexer.Position
@@ -214,6 +365,36 @@ type LoadOp struct {
 	Pos   lexer.Position
 }
 
+// TupleLiteralOp is a tuple of values, e.g. (q, true).
+type TupleLiteralOp struct {
+	Elems []ExpressionLike
+
+	Scope ScopeLike
+	Pos   lexer.Position
+}
+
+// LambdaOp is an anonymous function, e.g. fn [&sum] (i64 x) -> i64 { sum += x; return sum; }.
+type LambdaOp struct {
+	// Fn is the lambda as written, Transform makes a fresh copy of it for every function generated from it
+	Fn        *Function
+	Transform func(scope ScopeLike) *Function
+	Captures  []*Capture
+
+	closure *Function
+	plain   *Function
+
+	Scope ScopeLike
+	Pos   lexer.Position
+}
+
+// Capture is a local variable named in the capture list of a lambda.
+type Capture struct {
+	Ident     string
+	Reference bool
+
+	Pos lexer.Position
+}
+
 type ConstantBoolOp struct {
 	Constant string
 
@@ -0,0 +1,330 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+
+	"github.com/Astemirdum/si/pkg"
+)
+
+// Closures: a lambda is generated as a function of its own, with a hidden first parameter pointing to
+// its environment. The environment is a struct of the local variables of the enclosing functions the
+// body uses, found while it is generated. A variable is captured by value, copied when the lambda is
+// evaluated, or by reference if it is listed with & in the capture list. The environment is allocated
+// with malloc, so a closure can outlive the function that created it.
+// A lambda that captures nothing can also be used as a plain function pointer, e.g. a callback for C.
+
+// environment collects the captures of a lambda while its body is generated.
+type environment struct {
+	lambda *LambdaOp
+	// plain is set for a lambda generated as a plain function, which has no environment
+	plain bool
+	// refused is the first variable a plain lambda tried to capture
+	refused string
+
+	typ   *types.StructType
+	ptr   value.Value
+	entry *ir.Block
+
+	captured []*captured
+}
+
+type captured struct {
+	Outer     *Variable
+	Inner     *Variable
+	Reference bool
+}
+
+// isLocal reports whether v lives in the frame of a function, so a lambda must capture it.
+func isLocal(v *Variable) bool {
+	_, global := v.Ptr.(*ir.Global)
+
+	return v.Constant == nil && !global
+}
+
+// capture returns the variable of the lambda standing for the outer local v.
+// Its address is computed in the entry block, so it dominates every use in the body.
+func (e *environment) capture(v *Variable) *Variable {
+	for _, c := range e.captured {
+		if c.Outer == v {
+			return c.Inner
+		}
+	}
+
+	if e.plain {
+		if e.refused == "" {
+			e.refused = v.Ident
+		}
+
+		return nil
+	}
+
+	irType, err := v.Type.IRType()
+	if err != nil {
+		return nil
+	}
+
+	reference := false
+	for _, c := range e.lambda.Captures {
+		reference = reference || (c.Ident == v.Ident && c.Reference)
+	}
+
+	field := irType
+	if reference {
+		field = types.NewPointer(irType)
+	}
+
+	index := len(e.typ.Fields)
+	e.typ.Fields = append(e.typ.Fields, field)
+
+	var ptr value.Value = e.entry.NewGetElementPtr(e.typ, e.ptr, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, int64(index)))
+	if reference {
+		ptr = e.entry.NewLoad(field, ptr)
+	}
+
+	inner := &Variable{
+		Ident:   v.Ident,
+		Type:    v.Type,
+		IsConst: v.IsConst,
+		Ptr:     ptr,
+		Pos:     v.Pos,
+	}
+
+	e.captured = append(e.captured, &captured{Outer: v, Inner: inner, Reference: reference})
+
+	return inner
+}
+
+// prologue makes the environment parameter addressable, the body is generated in a block after the entry.
+func (e *environment) prologue(f *Function) {
+	m := f.CurrentModule().program()
+
+	e.entry = f.BasicBlock()
+
+	if !e.plain {
+		e.typ = types.NewStruct()
+		e.typ.SetName(m.GenerateID("env"))
+		m.Ptr.TypeDefs = append(m.Ptr.TypeDefs, e.typ)
+
+		env := e.entry.NewLoad(types.I8Ptr, f.Params[0].Ptr)
+		e.ptr = e.entry.NewBitCast(env, types.NewPointer(e.typ))
+	}
+
+	f.SetBasicBlock(f.Ptr.NewBlock("fn.body"))
+}
+
+func (l *LambdaOp) String() string {
+	captures := make([]string, 0, len(l.Captures))
+	for _, c := range l.Captures {
+		if c.Reference {
+			captures = append(captures, "&"+c.Ident)
+		} else {
+			captures = append(captures, c.Ident)
+		}
+	}
+
+	prefix := "fn"
+	if len(captures) > 0 {
+		prefix += " [" + strings.Join(captures, ", ") + "] "
+	}
+
+	body := make([]string, 0, len(l.Fn.Body))
+	for _, stmt := range l.Fn.Body {
+		for _, line := range stmt.String() {
+			body = append(body, strings.TrimSpace(line))
+		}
+	}
+
+	return fmt.Sprintf("%s(%s) -> %s %s", prefix, VariableList(l.Fn.Params).String(), l.Fn.ReturnType.String(), strings.Join(body, " "))
+}
+
+// Value returns a closure.
+func (l *LambdaOp) Value() (*Value, error) {
+	return l.ValueFor(nil)
+}
+
+// ValueFor returns a plain function pointer if a function type is expected, otherwise a closure.
+func (l *LambdaOp) ValueFor(expected *Type) (*Value, error) {
+	if expected != nil && expected.IsFunc() && !expected.IsClosure() {
+		fn, err := l.function(true)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Value{Type: fn.Type(), Value: fn.Ptr}, nil
+	}
+
+	fn, err := l.function(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.closureValue(fn)
+}
+
+// function generates the lambda once for each way it is used, its body is generated right away
+// to find its captures.
+func (l *LambdaOp) function(plain bool) (*Function, error) {
+	if plain && l.plain != nil {
+		return l.plain, nil
+	}
+
+	if !plain && l.closure != nil {
+		return l.closure, nil
+	}
+
+	m := l.Scope.CurrentModule()
+
+	fn := l.Transform(l.Scope)
+	prefix := "lambda"
+	if outer := l.Scope.CurrentFunction(); outer != nil {
+		prefix = outer.Name + ".lambda"
+	}
+
+	fn.Name = m.GenerateID(prefix)
+	fn.env = &environment{lambda: l, plain: plain}
+
+	for _, c := range l.Captures {
+		if v := l.Scope.FindVariable(c.Ident); v == nil || !isLocal(v) {
+			return nil, pkg.WithPos(fmt.Errorf("cannot capture '%s', it is not a local variable", c.Ident), l.Scope.Current().File, c.Pos)
+		}
+	}
+
+	if plain && len(l.Captures) > 0 {
+		return nil, pkg.WithPos(fmt.Errorf("lambda with captures cannot be used as %s", fn.Type().String()), l.Scope.Current().File, l.Pos)
+	}
+
+	if !plain {
+		env := &Variable{Type: NewTypeBasic(fn, l.Pos, BasicTypeVoid).NewPointer(), IsParam: true}
+		fn.Params = append([]*Variable{env}, fn.Params...)
+	}
+
+	if err := fn.Declare(); err != nil {
+		return nil, err
+	}
+
+	fn.Ptr.Linkage = enum.LinkageInternal
+
+	prev := m.BasicBlock()
+	err := fn.Generate()
+	m.SetBasicBlock(prev)
+
+	if fn.env.refused != "" {
+		return nil, pkg.WithPos(fmt.Errorf("lambda capturing '%s' cannot be used as %s", fn.env.refused, fn.Type().String()), l.Scope.Current().File, l.Pos)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the explicit captures are part of the environment, even if the body doesn't use them
+	for _, c := range l.Captures {
+		fn.env.capture(l.Scope.FindVariable(c.Ident))
+	}
+
+	fn.env.entry.NewBr(fn.Ptr.Blocks[1])
+
+	if plain {
+		l.plain = fn
+	} else {
+		l.closure = fn
+	}
+
+	return fn, nil
+}
+
+// closureValue builds the closure of fn, with a copy of the captured variables or their addresses.
+func (l *LambdaOp) closureValue(fn *Function) (*Value, error) {
+	bb := l.Scope.BasicBlock()
+	env := fn.env
+
+	params := make([]*Type, 0, len(fn.Params)-1)
+	for _, p := range fn.Params[1:] {
+		params = append(params, p.Type)
+	}
+
+	typ := NewTypeClosure(l.Scope, l.Pos, params, false, fn.ReturnType)
+
+	irType, err := typ.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	var data value.Value = NewNullPtr()
+
+	if len(env.captured) > 0 {
+		// sizeof the environment, as the offset of the second one in an array
+		size := constant.NewPtrToInt(constant.NewGetElementPtr(env.typ, constant.NewNull(types.NewPointer(env.typ)), constant.NewInt(types.I32, 1)), types.I64)
+
+		data = bb.NewCall(l.Scope.CurrentModule().program().malloc(), size)
+		ptr := bb.NewBitCast(data, types.NewPointer(env.typ))
+
+		for i, c := range env.captured {
+			field := bb.NewGetElementPtr(env.typ, ptr, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, int64(i)))
+
+			if c.Reference {
+				bb.NewStore(c.Outer.Ptr, field)
+				continue
+			}
+
+			bb.NewStore(bb.NewLoad(env.typ.Fields[i], c.Outer.Ptr), field)
+		}
+	}
+
+	fnPtr := castPointer(l.Scope, fn.Ptr, irType.(*types.StructType).Fields[0])
+	agg := bb.NewInsertValue(constant.NewUndef(irType), fnPtr, 0)
+
+	return &Value{Type: typ, Value: bb.NewInsertValue(agg, data, 1)}, nil
+}
+
+// malloc returns the C allocator, declared the first time it is needed.
+func (m *Module) malloc() *ir.Func {
+	for _, f := range m.Ptr.Funcs {
+		if f.Name() == "malloc" {
+			return f
+		}
+	}
+
+	return m.Ptr.NewFunc("malloc", types.I8Ptr, ir.NewParam("size", types.I64))
+}
+
+// closureCall calls the closure v, passing its environment before the arguments.
+func (f *FnCallOp) closureCall(name string, v *Value) (*Value, error) {
+	ft := v.Type.Func()
+
+	if len(f.Args) < len(ft.Params) {
+		return nil, pkg.WithPos(fmt.Errorf("not enough arguments in call to %s: expected %d, got %d", name, len(ft.Params), len(f.Args)), f.Scope.Current().File, f.Pos)
+	}
+
+	if len(f.Args) > len(ft.Params) {
+		return nil, pkg.WithPos(fmt.Errorf("too many arguments in call to %s: expected %d, got %d", name, len(ft.Params), len(f.Args)), f.Scope.Current().File, f.Pos)
+	}
+
+	bb := f.Scope.BasicBlock()
+	env := NewTypeBasic(f.Scope, f.Pos, BasicTypeVoid).NewPointer()
+
+	names := []string{"'env'"}
+	for i := range ft.Params {
+		names = append(names, fmt.Sprint(i+1))
+	}
+
+	call := &FnCallOp{
+		Ident: f.Ident,
+		Args:  append([]ExpressionLike{&valueOp{Expr: f, Val: &Value{Type: env, Value: bb.NewExtractValue(v.Value, 1)}}}, f.Args...),
+		Scope: f.Scope,
+		Pos:   f.Pos,
+	}
+
+	withEnv := &FuncType{
+		Params:     append([]*Type{env}, ft.Params...),
+		ReturnType: ft.ReturnType,
+	}
+
+	return call.call(name, withEnv, names, bb.NewExtractValue(v.Value, 0))
+}
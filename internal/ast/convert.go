@@ -0,0 +1,200 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+
+	"github.com/Astemirdum/si/pkg"
+)
+
+// Implicit conversions: a value of a numeric type converts to another numeric type without a cast
+// only if every value of its type is exactly representable in the other one. Narrowing conversions,
+// and numeric conversions involving aliases, need an explicit cast.
+
+func isNumeric(t *Type) bool {
+	return !t.IsAlias() && (t.IsInt() || t.IsUInt() || t.IsFloat())
+}
+
+// mantissaBits is the number of significant bits of a floating point type, including the implicit one.
+func mantissaBits(t *Type) int {
+	if t.Basic() == BasicTypeF32 {
+		return 24
+	}
+
+	return 53
+}
+
+// convertible reports whether from implicitly converts to to.
+// Besides numeric widening, void* converts to and from any other pointer.
+func convertible(from, to *Type) bool {
+	if from.IsPointer() && to.IsPointer() {
+		return from.IsVoidPointer() || to.IsVoidPointer()
+	}
+
+	if !isNumeric(from) || !isNumeric(to) {
+		return false
+	}
+
+	fromSize, toSize := from.BasicSize(), to.BasicSize()
+
+	switch {
+	case from.IsInt():
+		return (to.IsInt() && toSize >= fromSize) || (to.IsFloat() && fromSize <= mantissaBits(to))
+	case from.IsUInt():
+		return (to.IsUInt() && toSize >= fromSize) || (to.IsInt() && toSize > fromSize) || (to.IsFloat() && fromSize <= mantissaBits(to))
+	default:
+		return to.IsFloat() && toSize >= fromSize
+	}
+}
+
+// commonType returns the smallest type both a and b implicitly convert to, or nil if there is none.
+func commonType(a, b *Type) *Type {
+	candidates := []*Type{
+		a,
+		b,
+		NewTypeBasic(a.Scope, a.Pos, BasicTypeI16),
+		NewTypeBasic(a.Scope, a.Pos, BasicTypeI32),
+		NewTypeBasic(a.Scope, a.Pos, BasicTypeI64),
+		NewTypeBasic(a.Scope, a.Pos, BasicTypeF64),
+	}
+
+	for _, c := range candidates {
+		if convertible(a, c) && convertible(b, c) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// convert widens v to typ, which it must be convertible to.
+func convert(scope ScopeLike, v *Value, typ *Type) (*Value, error) {
+	if v.Type.Equals(typ) {
+		return v, nil
+	}
+
+	irType, err := typ.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Type.IsPointer() {
+		return &Value{Type: typ, Value: castPointer(scope, v.Value, irType)}, nil
+	}
+
+	if folded := foldCast(v, typ, irType); folded != nil {
+		return &Value{Type: typ, Value: folded}, nil
+	}
+
+	bb := scope.BasicBlock()
+
+	var result value.Value
+	switch {
+	case typ.IsFloat() && v.Type.IsFloat():
+		result = bb.NewFPExt(v.Value, irType)
+	case typ.IsFloat() && v.Type.IsInt():
+		result = bb.NewSIToFP(v.Value, irType)
+	case typ.IsFloat():
+		result = bb.NewUIToFP(v.Value, irType)
+	case v.Type.IsInt():
+		result = bb.NewSExt(v.Value, irType)
+	default:
+		result = bb.NewZExt(v.Value, irType)
+	}
+
+	return &Value{Type: typ, Value: result}, nil
+}
+
+// castPointer bitcasts a pointer to another pointer type, void* and i8* share their representation.
+func castPointer(scope ScopeLike, v value.Value, typ types.Type) value.Value {
+	if v.Type().Equal(typ) {
+		return v
+	}
+
+	if c, ok := v.(constant.Constant); ok {
+		return constant.NewBitCast(c, typ)
+	}
+
+	return scope.BasicBlock().NewBitCast(v, typ)
+}
+
+// valueAs evaluates expr for the expected type, like valueFor, and implicitly converts the result to it.
+// It is used wherever a value is assigned: declarations, assignments, returns, arguments and literal fields.
+// A pointer to a named type converts to an interface it implements, pos is where such a conversion is reported.
+func valueAs(scope ScopeLike, pos lexer.Position, expr ExpressionLike, expected *Type) (*Value, error) {
+	v, err := valueFor(expr, expected)
+	if err != nil || expected == nil {
+		return v, err
+	}
+
+	if expected.IsInterface() {
+		return toInterface(scope, pos, v, expected)
+	}
+
+	if !convertible(v.Type, expected) {
+		return v, nil
+	}
+
+	return convert(scope, v, expected)
+}
+
+// convertOperands applies the usual arithmetic conversions: operands of different numeric types
+// are converted to the smallest type both convert to. A shift only converts its count.
+func (b *BinaryOp) convertOperands(left, right *Value) (*Value, *Value, error) {
+	// a void* is compared as the type of the other pointer
+	if left.Type.IsPointer() && right.Type.IsPointer() && !left.Type.Equals(right.Type) {
+		var err error
+		if left.Type.IsVoidPointer() {
+			left, err = convert(b.Scope, left, right.Type)
+		} else if right.Type.IsVoidPointer() {
+			right, err = convert(b.Scope, right, left.Type)
+		}
+
+		return left, right, err
+	}
+
+	if left.Type.Equals(right.Type) || !isNumeric(left.Type) || !isNumeric(right.Type) {
+		return left, right, nil
+	}
+
+	if b.Op == "<<" || b.Op == ">>" {
+		if right.Type.IsFloat() || !convertible(right.Type, left.Type) {
+			return left, right, nil
+		}
+
+		right, err := convert(b.Scope, right, left.Type)
+
+		return left, right, err
+	}
+
+	typ := commonType(left.Type, right.Type)
+	if typ == nil {
+		signed, unsigned := left.Type, right.Type
+		if signed.IsUInt() {
+			signed, unsigned = unsigned, signed
+		}
+
+		if isComparison(b.Op) && signed.IsInt() && unsigned.IsUInt() {
+			return nil, nil, pkg.WithPos(fmt.Errorf("comparison of signed %s and unsigned %s needs an explicit cast", signed.String(), unsigned.String()), b.Scope.Current().File, b.Pos)
+		}
+
+		// left for apply to report as incompatible
+		return left, right, nil
+	}
+
+	left, err := convert(b.Scope, left, typ)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	right, err = convert(b.Scope, right, typ)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return left, right, nil
+}
@@ -0,0 +1,156 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// escapes maps the single character C escapes to the byte they stand for.
+var escapes = map[byte]byte{
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'a':  '\a',
+	'b':  '\b',
+	'f':  '\f',
+	'v':  '\v',
+	'\\': '\\',
+	'\'': '\'',
+	'"':  '"',
+	'?':  '?',
+}
+
+// escapeError is an invalid escape sequence at Offset in the source of a literal.
+type escapeError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *escapeError) Error() string {
+	return e.Msg
+}
+
+// unescape decodes the escape sequences of a char or string literal: the C escapes,
+// \xHH, octal \NNN and \u{...}, which is encoded as UTF-8.
+func unescape(s string) (string, error) {
+	sb := strings.Builder{}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		start := i
+		if i+1 == len(s) {
+			return "", &escapeError{Offset: start, Msg: "unterminated escape sequence"}
+		}
+
+		i++
+		c := s[i]
+
+		if b, ok := escapes[c]; ok {
+			sb.WriteByte(b)
+			continue
+		}
+
+		switch {
+		case c >= '0' && c <= '7':
+			n := 0
+			for j := 0; j < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; j++ {
+				n = n*8 + int(s[i]-'0')
+				i++
+			}
+			i--
+
+			if n > 0xFF {
+				return "", &escapeError{Offset: start, Msg: fmt.Sprintf("octal escape sequence %s out of range", s[start:i+1])}
+			}
+
+			sb.WriteByte(byte(n))
+		case c == 'x':
+			n, digits := 0, 0
+			for digits < 2 && i+1 < len(s) && isHexDigit(s[i+1]) {
+				i++
+				n = n*16 + hexValue(s[i])
+				digits++
+			}
+
+			if digits == 0 {
+				return "", &escapeError{Offset: start, Msg: "missing hex digits in escape sequence \\x"}
+			}
+
+			sb.WriteByte(byte(n))
+		case c == 'u':
+			end := strings.IndexByte(s[i:], '}')
+			if i+1 == len(s) || s[i+1] != '{' || end == -1 {
+				return "", &escapeError{Offset: start, Msg: "invalid unicode escape sequence, expected \\u{...}"}
+			}
+
+			digits := s[i+2 : i+end]
+			i += end
+
+			r := rune(0)
+			for j := 0; j < len(digits); j++ {
+				if !isHexDigit(digits[j]) || j == 6 {
+					return "", &escapeError{Offset: start, Msg: fmt.Sprintf("invalid unicode escape sequence %s", s[start:i+1])}
+				}
+
+				r = r*16 + rune(hexValue(digits[j]))
+			}
+
+			if len(digits) == 0 || !utf8.ValidRune(r) {
+				return "", &escapeError{Offset: start, Msg: fmt.Sprintf("invalid unicode escape sequence %s", s[start:i+1])}
+			}
+
+			sb.WriteRune(r)
+		default:
+			return "", &escapeError{Offset: start, Msg: fmt.Sprintf("invalid escape sequence \\%c", c)}
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) int {
+	switch {
+	case c >= 'a':
+		return int(c-'a') + 10
+	case c >= 'A':
+		return int(c-'A') + 10
+	default:
+		return int(c - '0')
+	}
+}
+
+// escapePos returns the position of the escape sequence that failed to decode,
+// given the position of the literal and its source without the opening quote.
+func escapePos(pos lexer.Position, s string, err error) lexer.Position {
+	ee, ok := err.(*escapeError)
+	if !ok {
+		return pos
+	}
+
+	// skip the opening quote
+	pos.Offset++
+	pos.Column++
+
+	for _, c := range s[:ee.Offset] {
+		pos.Offset += utf8.RuneLen(c)
+		if c == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+
+	return pos
+}
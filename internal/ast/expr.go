@@ -1,12 +1,17 @@
 package ast
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/Astemirdum/si/pkg"
 
+	"github.com/alecthomas/participle/v2/lexer"
 	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
 	"github.com/llir/llvm/ir/enum"
@@ -24,17 +29,137 @@ func (e ExpressionLikeList) String() string {
 	return strings.Join(ret, ", ")
 }
 
+// valueFor evaluates expr in a context that expects a value of the given type.
+func valueFor(expr ExpressionLike, expected *Type) (*Value, error) {
+	if ce, ok := expr.(ContextualExpressionLike); ok && expected != nil {
+		return ce.ValueFor(expected)
+	}
+
+	return expr.Value()
+}
+
 func (b *BinaryOp) String() string {
-	return fmt.Sprintf("%s %s %s", b.Left.String(), b.Op, b.Right.String())
+	return fmt.Sprintf("%s %s %s", operandString(b.Op, b.Left, false), b.Op, operandString(b.Op, b.Right, true))
+}
+
+// precedence returns how tightly a binary operator binds, as in the grammar.
+func precedence(op string) int {
+	switch op {
+	case "||":
+		return 1
+	case "&&":
+		return 2
+	case "|":
+		return 3
+	case "^":
+		return 4
+	case "&":
+		return 5
+	case "==", "!=":
+		return 6
+	case "<", ">", "<=", ">=":
+		return 7
+	case "<<", ">>":
+		return 8
+	case "+", "-":
+		return 9
+	default:
+		return 10
+	}
+}
+
+// operandString keeps the grouping of an operand of op, which the parser drops with the parentheses,
+// e.g. (1 << 62) * 4 or a - (b - c).
+func operandString(op string, expr ExpressionLike, right bool) string {
+	operand, ok := expr.(*BinaryOp)
+	if !ok {
+		return expr.String()
+	}
+
+	associative := op == "+" || op == "*" || op == "&" || op == "|" || op == "^" || op == "&&" || op == "||"
+
+	if p := precedence(operand.Op); p < precedence(op) || (right && p == precedence(op) && !associative) {
+		return "(" + expr.String() + ")"
+	}
+
+	return expr.String()
+}
+
+// isUntyped reports whether expr is built only from untyped number literals, so its type comes from the context.
+func isUntyped(expr ExpressionLike) bool {
+	switch e := expr.(type) {
+	case *ConstantNumberOp:
+		return e.IsUntyped()
+	case *UnaryOp:
+		return e.Op == "-" && isUntyped(e.Expr)
+	case *BinaryOp:
+		return !isComparison(e.Op) && e.Op != "&&" && e.Op != "||" && isUntyped(e.Left) && isUntyped(e.Right)
+	}
+
+	return false
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", "<", ">", "<=", ">=":
+		return true
+	}
+
+	return false
 }
 
 func (b *BinaryOp) Value() (*Value, error) {
-	left, err := b.Left.Value()
+	return b.ValueFor(nil)
+}
+
+// ValueFor passes the expected type down to the operands, and an untyped operand
+// takes the type of the other one. Comparisons produce bool, so their operands
+// only take their types from each other.
+func (b *BinaryOp) ValueFor(expected *Type) (*Value, error) {
+	if b.Op == "&&" || b.Op == "||" {
+		return b.logicalValue()
+	}
+
+	if isComparison(b.Op) {
+		expected = nil
+	}
+
+	// an expression of untyped literals is folded exactly and typed as a whole, so i8 x = 127 + 1 overflows
+	if isUntyped(b) {
+		return untypedValue(b.Scope, b.Pos, b, expected)
+	}
+
+	// literals have no side effects, so the right operand can be evaluated first
+	if isUntyped(b.Left) && !isUntyped(b.Right) {
+		right, err := valueFor(b.Right, expected)
+		if err != nil {
+			return nil, err
+		}
+
+		left, err := valueFor(b.Left, right.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		return b.apply(left, right)
+	}
+
+	left, err := valueFor(b.Left, expected)
 	if err != nil {
 		return nil, err
 	}
 
-	right, err := b.Right.Value()
+	right, err := valueFor(b.Right, left.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.apply(left, right)
+}
+
+// apply computes the operation on already evaluated operands.
+func (b *BinaryOp) apply(left, right *Value) (*Value, error) {
+	left, right, err := b.convertOperands(left, right)
 	if err != nil {
 		return nil, err
 	}
@@ -45,6 +170,10 @@ func (b *BinaryOp) Value() (*Value, error) {
 	// if eithe left or right is a pointer, we need to do some pointer arithmetic
 	switch {
 	case left.Type.IsPointer() && !right.Type.IsPointer() && right.Type.IsInt():
+		if left.Type.IsVoidPointer() && (b.Op == "+" || b.Op == "-") {
+			return nil, pkg.WithPos(fmt.Errorf("cannot do arithmetic on %s", left.Type.String()), b.Scope.Current().File, b.Pos)
+		}
+
 		ptrIRType, err := left.Type.Pointer().IRType()
 		if err != nil {
 			return nil, err
@@ -67,6 +196,10 @@ func (b *BinaryOp) Value() (*Value, error) {
 			result = bb.NewICmp(enum.IPredNE, ptrInt, right.Value)
 		}
 	case !left.Type.IsPointer() && right.Type.IsPointer() && left.Type.IsInt():
+		if right.Type.IsVoidPointer() && b.Op == "+" {
+			return nil, pkg.WithPos(fmt.Errorf("cannot do arithmetic on %s", right.Type.String()), b.Scope.Current().File, b.Pos)
+		}
+
 		ptrIRType, err := right.Type.Pointer().IRType()
 		if err != nil {
 			return nil, err
@@ -86,12 +219,15 @@ func (b *BinaryOp) Value() (*Value, error) {
 		}
 	case !left.Type.Equals(right.Type):
 		return nil, pkg.WithPos(fmt.Errorf("incompatible types %s and %s", left.Type.String(), right.Type.String()), b.Scope.Current().File, b.Pos)
+	case (left.Type.IsBasic() || left.Type.IsEnum()) && isConstant(left.Value) && isConstant(right.Value):
+		folded, err := foldBinary(b.Op, left.Type, left.Value, right.Value)
+		if err != nil {
+			return nil, pkg.WithPos(err, b.Scope.Current().File, b.Pos)
+		}
+
+		result = folded
 	case left.Type.IsBool():
 		switch b.Op {
-		case "&&":
-			result = bb.NewAnd(left.Value, right.Value)
-		case "||":
-			result = bb.NewOr(left.Value, right.Value)
 		case "==":
 			result = bb.NewICmp(enum.IPredEQ, left.Value, right.Value)
 		case "!=":
@@ -130,6 +266,10 @@ func (b *BinaryOp) Value() (*Value, error) {
 			result = bb.NewSDiv(left.Value, right.Value)
 		case "%":
 			result = bb.NewSRem(left.Value, right.Value)
+		case "<<":
+			result = bb.NewShl(left.Value, right.Value)
+		case ">>":
+			result = bb.NewAShr(left.Value, right.Value)
 		}
 	case left.Type.IsUInt():
 		switch b.Op {
@@ -164,6 +304,10 @@ func (b *BinaryOp) Value() (*Value, error) {
 			result = bb.NewUDiv(left.Value, right.Value)
 		case "%":
 			result = bb.NewURem(left.Value, right.Value)
+		case "<<":
+			result = bb.NewShl(left.Value, right.Value)
+		case ">>":
+			result = bb.NewLShr(left.Value, right.Value)
 		}
 	case left.Type.IsFloat():
 		switch b.Op {
@@ -192,6 +336,8 @@ func (b *BinaryOp) Value() (*Value, error) {
 		}
 	case left.Type.IsPointer():
 		switch b.Op {
+		case "-":
+			return b.pointerDifference(left, right)
 		case "==":
 			result = bb.NewICmp(enum.IPredEQ, left.Value, right.Value)
 		case "!=":
@@ -205,6 +351,34 @@ func (b *BinaryOp) Value() (*Value, error) {
 		case ">=":
 			result = bb.NewICmp(enum.IPredUGE, left.Value, right.Value)
 		}
+	case left.Type.IsEnum():
+		switch b.Op {
+		case "==":
+			result = bb.NewICmp(enum.IPredEQ, left.Value, right.Value)
+		case "!=":
+			result = bb.NewICmp(enum.IPredNE, left.Value, right.Value)
+		case "<":
+			result = bb.NewICmp(enum.IPredSLT, left.Value, right.Value)
+		case ">":
+			result = bb.NewICmp(enum.IPredSGT, left.Value, right.Value)
+		case "<=":
+			result = bb.NewICmp(enum.IPredSLE, left.Value, right.Value)
+		case ">=":
+			result = bb.NewICmp(enum.IPredSGE, left.Value, right.Value)
+		}
+	case left.Type.IsFunc():
+		// closures are compared by their function
+		if left.Type.IsClosure() {
+			left = &Value{Type: left.Type, Value: bb.NewExtractValue(left.Value, 0)}
+			right = &Value{Type: right.Type, Value: bb.NewExtractValue(right.Value, 0)}
+		}
+
+		switch b.Op {
+		case "==":
+			result = bb.NewICmp(enum.IPredEQ, left.Value, right.Value)
+		case "!=":
+			result = bb.NewICmp(enum.IPredNE, left.Value, right.Value)
+		}
 	}
 
 	if result == nil {
@@ -225,13 +399,212 @@ func (b *BinaryOp) Value() (*Value, error) {
 	}, nil
 }
 
+// pointerDifference subtracts two pointers of the same type, the result is the number of elements between them.
+func (b *BinaryOp) pointerDifference(left, right *Value) (*Value, error) {
+	if left.Type.IsVoidPointer() {
+		return nil, pkg.WithPos(fmt.Errorf("cannot do arithmetic on %s", left.Type.String()), b.Scope.Current().File, b.Pos)
+	}
+
+	size, _, err := left.Type.Pointer().Layout()
+	if err != nil {
+		return nil, err
+	}
+
+	if size == 0 {
+		return nil, pkg.WithPos(fmt.Errorf("cannot subtract pointers to zero-sized %s", left.Type.Pointer().String()), b.Scope.Current().File, b.Pos)
+	}
+
+	bb := b.Scope.BasicBlock()
+	diff := bb.NewSub(bb.NewPtrToInt(left.Value, types.I64), bb.NewPtrToInt(right.Value, types.I64))
+
+	// the distance is always a multiple of the element size
+	div := bb.NewSDiv(diff, NewLLInt(64, size))
+	div.Exact = true
+
+	return &Value{
+		Type:  NewTypeBasic(b.Scope, b.Pos, BasicTypeI64),
+		Value: div,
+	}, nil
+}
+
+// logicalValue lowers && and || with short-circuit evaluation: the right operand is evaluated
+// in its own block only if the left operand doesn't already decide the result.
+func (b *BinaryOp) logicalValue() (*Value, error) {
+	left, err := b.Left.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	if !left.Type.IsBool() {
+		return nil, pkg.WithPos(fmt.Errorf("operation %s is not implemented for %s", b.Op, left.Type), b.Scope.Current().File, b.Pos)
+	}
+
+	// a constant left operand either decides the result or the result is the right operand
+	if c, ok := left.Value.(*constant.Int); ok {
+		if (c.X.Sign() != 0) == (b.Op == "||") {
+			return left, nil
+		}
+
+		right, err := b.Right.Value()
+		if err != nil {
+			return nil, err
+		}
+
+		if !right.Type.IsBool() {
+			return nil, pkg.WithPos(fmt.Errorf("incompatible types %s and %s", left.Type.String(), right.Type.String()), b.Scope.Current().File, b.Pos)
+		}
+
+		return right, nil
+	}
+
+	fn := b.Scope.CurrentFunction()
+	if fn == nil {
+		return nil, pkg.WithPos(fmt.Errorf("operation %s is only allowed inside a function", b.Op), b.Scope.Current().File, b.Pos)
+	}
+
+	m := b.Scope.CurrentModule()
+	rhsBlock := fn.Ptr.NewBlock(m.GenerateID("logical.rhs"))
+	mergeBlock := fn.Ptr.NewBlock(m.GenerateID("logical.merge"))
+
+	// the left operand may have created blocks itself (e.g. nested && or ||), so we branch from the current one
+	lhsBlock := b.Scope.BasicBlock()
+
+	// short-circuit result: false for &&, true for ||
+	shortCircuit := NewLLBool(b.Op == "||")
+	if b.Op == "&&" {
+		lhsBlock.NewCondBr(left.Value, rhsBlock, mergeBlock)
+	} else {
+		lhsBlock.NewCondBr(left.Value, mergeBlock, rhsBlock)
+	}
+
+	// right operand block
+	b.Scope.SetBasicBlock(rhsBlock)
+	right, err := b.Right.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	if !right.Type.IsBool() {
+		return nil, pkg.WithPos(fmt.Errorf("incompatible types %s and %s", left.Type.String(), right.Type.String()), b.Scope.Current().File, b.Pos)
+	}
+
+	rhsEnd := b.Scope.BasicBlock()
+	rhsEnd.NewBr(mergeBlock)
+
+	// merge block
+	b.Scope.SetBasicBlock(mergeBlock)
+	phi := mergeBlock.NewPhi(ir.NewIncoming(shortCircuit, lhsBlock), ir.NewIncoming(right.Value, rhsEnd))
+
+	return &Value{
+		Type:  NewTypeBasic(b.Scope, b.Pos, BasicTypeBool),
+		Value: phi,
+	}, nil
+}
+
+func (c *ConditionalOp) String() string {
+	return fmt.Sprintf("%s ? %s : %s", c.Condition.String(), c.Then.String(), c.Else.String())
+}
+
+// Value lowers the conditional operator like an if statement, with a phi node in the merge block,
+// so only the selected arm is evaluated.
+func (c *ConditionalOp) Value() (*Value, error) {
+	return c.ValueFor(nil)
+}
+
+// ValueFor passes the expected type to both branches, the else branch defaults to the type of the then branch.
+func (c *ConditionalOp) ValueFor(expected *Type) (*Value, error) {
+	fn := c.Scope.CurrentFunction()
+	if fn == nil {
+		return nil, pkg.WithPos(fmt.Errorf("conditional operator is only allowed inside a function"), c.Scope.Current().File, c.Pos)
+	}
+
+	cond, err := c.Condition.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	if !cond.Type.IsBool() {
+		return nil, pkg.WithPos(fmt.Errorf("cannot use %s as condition", cond.Type.String()), c.Scope.Current().File, c.Pos)
+	}
+
+	m := c.Scope.CurrentModule()
+	thenBlock := fn.Ptr.NewBlock(m.GenerateID("cond.then"))
+	elseBlock := fn.Ptr.NewBlock(m.GenerateID("cond.else"))
+	mergeBlock := fn.Ptr.NewBlock(m.GenerateID("cond.merge"))
+
+	c.Scope.BasicBlock().NewCondBr(cond.Value, thenBlock, elseBlock)
+
+	// then block
+	c.Scope.SetBasicBlock(thenBlock)
+	then, err := valueFor(c.Then, expected)
+	if err != nil {
+		return nil, err
+	}
+
+	thenEnd := c.Scope.BasicBlock()
+	thenEnd.NewBr(mergeBlock)
+
+	// else block
+	c.Scope.SetBasicBlock(elseBlock)
+	els, err := valueFor(c.Else, then.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	elseEnd := c.Scope.BasicBlock()
+	elseEnd.NewBr(mergeBlock)
+
+	if !then.Type.Equals(els.Type) {
+		return nil, pkg.WithPos(fmt.Errorf("incompatible types %s and %s", then.Type.String(), els.Type.String()), c.Scope.Current().File, c.Pos)
+	}
+
+	if then.Type.IsVoid() {
+		return nil, pkg.WithPos(fmt.Errorf("conditional operator cannot have void type"), c.Scope.Current().File, c.Pos)
+	}
+
+	// merge block
+	c.Scope.SetBasicBlock(mergeBlock)
+	phi := mergeBlock.NewPhi(ir.NewIncoming(then.Value, thenEnd), ir.NewIncoming(els.Value, elseEnd))
+
+	return &Value{
+		Type:  then.Type,
+		Value: phi,
+	}, nil
+}
+
 func (u *UnaryOp) String() string {
+	if _, ok := u.Expr.(*BinaryOp); ok {
+		return fmt.Sprintf("%s (%s)", u.Op, u.Expr.String())
+	}
+
 	return fmt.Sprintf("%s %s", u.Op, u.Expr.String())
 }
 
 func (u *UnaryOp) Value() (*Value, error) {
-	original, err := u.Expr.Value()
+	return u.ValueFor(nil)
+}
+
+// ValueFor passes the expected type to the operand of a negation.
+func (u *UnaryOp) ValueFor(expected *Type) (*Value, error) {
+	if u.Op != "-" {
+		expected = nil
+	}
+
+	// a negated literal is typed as a whole, so that the minimum of a type fits, e.g. i8 x = -128
+	if c, ok := u.Expr.(*ConstantNumberOp); ok && u.Op == "-" {
+		sign := "-"
+		if c.Sign == "-" {
+			sign = ""
+		}
 
+		return (&ConstantNumberOp{Sign: sign, Constant: c.Constant, Scope: c.Scope, Pos: c.Pos}).ValueFor(expected)
+	}
+
+	if u.Op == "-" && isUntyped(u.Expr) {
+		return untypedValue(u.Scope, u.Pos, u, expected)
+	}
+
+	original, err := valueFor(u.Expr, expected)
 	if err != nil {
 		return nil, err
 	}
@@ -243,15 +616,27 @@ func (u *UnaryOp) Value() (*Value, error) {
 		return nil, err
 	}
 
+	if folded := foldUnary(u.Op, original.Type, original.Value); folded != nil {
+		return &Value{Type: original.Type, Value: folded}, nil
+	}
+
 	switch u.Op {
 	case "--", "++":
 		if original.Ptr == nil {
 			return nil, pkg.WithPos(fmt.Errorf("cannot increment/decrement a value that's not stored in memory"), u.Scope.Current().File, u.Pos)
 		}
 
+		if original.Const {
+			return nil, pkg.WithPos(fmt.Errorf("cannot increment/decrement a constant"), u.Scope.Current().File, u.Pos)
+		}
+
 		// load the value, just in case in has been modified
 		original.Value = u.Scope.BasicBlock().NewLoad(irType, original.Ptr)
 
+		if original.Type.IsVoidPointer() {
+			return nil, pkg.WithPos(fmt.Errorf("cannot do arithmetic on %s", original.Type.String()), u.Scope.Current().File, u.Pos)
+		}
+
 		if original.Type.IsPointer() {
 			ptrIRType, err := original.Type.Pointer().IRType()
 			if err != nil {
@@ -332,16 +717,30 @@ func (u *UnaryOp) Value() (*Value, error) {
 
 		return &Value{Type: original.Type, Value: result}, nil
 	case "&":
+		// a function is already an address, so &f is the same as f
+		if original.Type.IsFunc() && !original.Type.IsClosure() && original.Ptr == nil {
+			return original, nil
+		}
+
 		if original.Ptr == nil {
 			return nil, pkg.WithPos(fmt.Errorf("cannot take the address of a non-variable"), u.Scope.Current().File, u.Pos)
 		}
 
+		// constants are in read-only memory, a pointer would allow writing to them
+		if original.Const {
+			return nil, pkg.WithPos(fmt.Errorf("cannot take the address of constant %s", sourceString(u.Expr)), u.Scope.Current().File, u.Pos)
+		}
+
 		return &Value{Type: original.Type.NewPointer(), Value: original.Ptr}, nil
 	case "*":
 		if !original.Type.IsPointer() {
 			return nil, pkg.WithPos(fmt.Errorf("cannot dereference a non-pointer type"), u.Scope.Current().File, u.Pos)
 		}
 
+		if original.Type.IsVoidPointer() {
+			return nil, pkg.WithPos(fmt.Errorf("cannot dereference %s", original.Type.String()), u.Scope.Current().File, u.Pos)
+		}
+
 		ptr := original.Type.Pointer()
 
 		ptrIRType, err := ptr.IRType()
@@ -364,6 +763,10 @@ func (ao *AccessorOp) String() string {
 }
 
 func (ao *AccessorOp) Value() (*Value, error) {
+	if v, ok, err := ao.enumValue(); ok {
+		return v, err
+	}
+
 	expr, err := ao.Expr.Value()
 
 	if err != nil {
@@ -371,7 +774,7 @@ func (ao *AccessorOp) Value() (*Value, error) {
 	}
 
 	if ao.Dereference {
-		if !expr.Type.IsPointer() {
+		if !expr.Type.IsPointer() || expr.Type.IsVoidPointer() {
 			return nil, pkg.WithPos(fmt.Errorf("cannot dereference a non-pointer type %s", expr.Type.String()), ao.Scope.Current().File, ao.Pos)
 		}
 
@@ -389,19 +792,39 @@ func (ao *AccessorOp) Value() (*Value, error) {
 		}
 	}
 
-	if !expr.Type.IsStruct() {
-		return nil, pkg.WithPos(fmt.Errorf("cannot access field of non-struct type %s", expr.Type.String()), ao.Scope.Current().File, ao.Pos)
+	if expr.Type.IsUnion() {
+		return ao.unionValue(expr)
 	}
 
-	if expr.Ptr == nil {
-		return nil, pkg.WithPos(fmt.Errorf("cannot access field of non-variable"), ao.Scope.Current().File, ao.Pos)
+	var index int
+	var fieldType *Type
+
+	switch {
+	case expr.Type.IsTuple():
+		index, fieldType, err = expr.Type.Tuple().FindElement(ao.Field)
+	case expr.Type.IsStruct():
+		var field *StructField
+		index, field, err = expr.Type.Struct().FindField(ao.Field)
+
+		if field != nil {
+			fieldType = field.Type
+		}
+	default:
+		return nil, pkg.WithPos(fmt.Errorf("cannot access field of non-struct type %s", expr.Type.String()), ao.Scope.Current().File, ao.Pos)
 	}
 
-	index, field, err := expr.Type.Struct().FindField(ao.Field)
 	if err != nil {
 		return nil, pkg.WithPos(err, ao.Scope.Current().File, ao.Pos)
 	}
 
+	// e.g. a struct literal or a struct returned from a function
+	if expr.Ptr == nil {
+		return &Value{
+			Type:  fieldType,
+			Value: ao.Scope.BasicBlock().NewExtractValue(expr.Value, uint64(index)),
+		}, nil
+	}
+
 	exprIRType, err := expr.Type.IRType()
 	if err != nil {
 		return nil, err
@@ -409,7 +832,7 @@ func (ao *AccessorOp) Value() (*Value, error) {
 
 	ptr := ao.Scope.BasicBlock().NewGetElementPtr(exprIRType, expr.Ptr, NewLLInt(32, 0), NewLLInt(32, index))
 
-	fieldIRType, err := field.Type.IRType()
+	fieldIRType, err := fieldType.IRType()
 	if err != nil {
 		return nil, err
 	}
@@ -417,9 +840,10 @@ func (ao *AccessorOp) Value() (*Value, error) {
 	loaded := ao.Scope.BasicBlock().NewLoad(fieldIRType, ptr)
 
 	return &Value{
-		Type:  field.Type,
+		Type:  fieldType,
 		Ptr:   ptr,
 		Value: loaded,
+		Const: expr.Const,
 	}, nil
 }
 
@@ -446,6 +870,10 @@ func (io *IndexOp) Value() (*Value, error) {
 
 	bb := io.Scope.BasicBlock()
 
+	if expr.Type.IsVoidPointer() {
+		return nil, pkg.WithPos(fmt.Errorf("cannot index %s", expr.Type.String()), io.Scope.Current().File, io.Pos)
+	}
+
 	if expr.Type.IsPointer() {
 		ptr := expr.Type.Pointer()
 
@@ -488,12 +916,37 @@ func (io *IndexOp) Value() (*Value, error) {
 			Type:  elemType,
 			Ptr:   addr,
 			Value: result,
+			Const: expr.Const,
 		}, nil
 	} else {
 		return nil, pkg.WithPos(fmt.Errorf("can only index pointers or arrays, but type is %s", expr.Type.String()), io.Scope.Current().File, io.Pos)
 	}
 }
 
+// enumValue resolves Alias.MEMBER to the constant of an enum member.
+// ok is false when the accessor is not an enum member.
+func (ao *AccessorOp) enumValue() (*Value, bool, error) {
+	load, ok := ao.Expr.(*LoadOp)
+	if !ok || ao.Dereference || ao.Scope.FindVariable(load.Name) != nil {
+		return nil, false, nil
+	}
+
+	td := ao.Scope.FindTypeDefByAlias(load.Name)
+	if td == nil || !td.Type.IsEnum() {
+		return nil, false, nil
+	}
+
+	member, err := td.Type.Enum().FindMember(ao.Field)
+	if err != nil {
+		return nil, true, pkg.WithPos(err, ao.Scope.Current().File, ao.Pos)
+	}
+
+	return &Value{
+		Type:  NewTypeAlias(ao.Scope, ao.Pos, load.Name),
+		Value: constant.NewInt(EnumBackingType(), member.Value),
+	}, true, nil
+}
+
 func (c *CastingOp) String() string {
 	return "(" + c.Type.String() + ")" + c.Expr.String()
 }
@@ -512,18 +965,58 @@ func (c *CastingOp) Value() (*Value, error) {
 		return &Value{Type: c.Type, Value: expr.Value}, nil
 	}
 
+	return c.cast(expr, c.Type)
+}
+
+// cast converts an evaluated value to typ.
+func (c *CastingOp) cast(expr *Value, typ *Type) (*Value, error) {
+	// enums are converted through their backing integer type
+	backing := NewTypeBasic(c.Scope, c.Pos, BasicTypeI64)
+
+	if expr.Type.IsEnum() {
+		if typ.IsEnum() {
+			return &Value{Type: typ, Value: expr.Value}, nil
+		}
+
+		expr = &Value{Type: backing, Value: expr.Value}
+	}
+
+	if typ.IsEnum() {
+		if !expr.Type.IsInt() && !expr.Type.IsUInt() {
+			return nil, pkg.WithPos(fmt.Errorf("casting from %s to %s not implemented", expr.Type.String(), typ.String()), c.Scope.Current().File, c.Pos)
+		}
+
+		v, err := c.cast(expr, backing)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Value{Type: typ, Value: v.Value}, nil
+	}
+
 	var result value.Value
 
-	targetIRType, err := c.Type.IRType()
+	targetIRType, err := typ.IRType()
 	if err != nil {
 		return nil, err
 	}
 
-	if c.Type.IsInt() {
+	if typ.IsBasic() {
+		if folded := foldCast(expr, typ, targetIRType); folded != nil {
+			return &Value{Type: typ, Value: folded}, nil
+		}
+	}
+
+	// widening keeps the value, e.g. an unsigned value is zero extended
+	if convertible(expr.Type, typ) {
+		return convert(c.Scope, expr, typ)
+	}
+
+	if typ.IsInt() {
 		if expr.Type.IsInt() || expr.Type.IsUInt() {
-			if c.Type.BasicSize() > expr.Type.BasicSize() {
+			if typ.BasicSize() > expr.Type.BasicSize() {
 				result = c.Scope.BasicBlock().NewSExt(expr.Value, targetIRType)
-			} else if c.Type.BasicSize() < expr.Type.BasicSize() {
+			} else if typ.BasicSize() < expr.Type.BasicSize() {
 				result = c.Scope.BasicBlock().NewTrunc(expr.Value, targetIRType)
 			} else {
 				result = expr.Value
@@ -531,11 +1024,11 @@ func (c *CastingOp) Value() (*Value, error) {
 		} else if expr.Type.IsFloat() {
 			result = c.Scope.BasicBlock().NewFPToSI(expr.Value, targetIRType)
 		}
-	} else if c.Type.IsUInt() {
+	} else if typ.IsUInt() {
 		if expr.Type.IsInt() || expr.Type.IsUInt() {
-			if c.Type.BasicSize() > expr.Type.BasicSize() {
+			if typ.BasicSize() > expr.Type.BasicSize() {
 				result = c.Scope.BasicBlock().NewZExt(expr.Value, targetIRType)
-			} else if c.Type.BasicSize() < expr.Type.BasicSize() {
+			} else if typ.BasicSize() < expr.Type.BasicSize() {
 				result = c.Scope.BasicBlock().NewTrunc(expr.Value, targetIRType)
 			} else {
 				result = expr.Value
@@ -543,13 +1036,17 @@ func (c *CastingOp) Value() (*Value, error) {
 		} else if expr.Type.IsFloat() {
 			result = c.Scope.BasicBlock().NewFPToUI(expr.Value, targetIRType)
 		}
-	} else if c.Type.IsFloat() && expr.Type.IsFloat() {
-		if c.Type.BasicSize() > expr.Type.BasicSize() {
+	} else if typ.IsFloat() && expr.Type.IsInt() {
+		result = c.Scope.BasicBlock().NewSIToFP(expr.Value, targetIRType)
+	} else if typ.IsFloat() && expr.Type.IsUInt() {
+		result = c.Scope.BasicBlock().NewUIToFP(expr.Value, targetIRType)
+	} else if typ.IsFloat() && expr.Type.IsFloat() {
+		if typ.BasicSize() > expr.Type.BasicSize() {
 			result = c.Scope.BasicBlock().NewFPExt(expr.Value, targetIRType)
 		} else {
 			result = c.Scope.BasicBlock().NewFPTrunc(expr.Value, targetIRType)
 		}
-	} else if c.Type.IsPointer() {
+	} else if typ.IsPointer() {
 		if expr.Type.IsPointer() {
 			result = c.Scope.BasicBlock().NewBitCast(expr.Value, targetIRType)
 		} else if expr.Type.IsArray() {
@@ -567,88 +1064,402 @@ func (c *CastingOp) Value() (*Value, error) {
 	}
 
 	if result == nil {
-		return nil, pkg.WithPos(fmt.Errorf("casting from %s to %s not implemented", expr.Type.String(), c.Type.String()), c.Scope.Current().File, c.Pos)
+		return nil, pkg.WithPos(fmt.Errorf("casting from %s to %s not implemented", expr.Type.String(), typ.String()), c.Scope.Current().File, c.Pos)
 	}
 
 	return &Value{
-		Type:  c.Type,
+		Type:  typ,
 		Value: result,
 	}, nil
 
 }
 
+func (s *StructLiteralOp) String() string {
+	fields := make([]string, 0, len(s.Fields))
+	for _, f := range s.Fields {
+		fields = append(fields, "."+f.Ident+" = "+f.Expr.String())
+	}
+
+	return fmt.Sprintf("%s{ %s }", s.Type.String(), strings.Join(fields, ", "))
+}
+
+func (s *StructLiteralOp) Value() (*Value, error) {
+	if s.Scope.FindTypeDefByAlias(s.Type.Alias()) == nil {
+		return nil, pkg.WithPos(fmt.Errorf("unknown type alias '%s'", s.Type.Alias()), s.Scope.Current().File, s.Pos)
+	}
+
+	if s.Type.IsUnion() {
+		return s.unionValue()
+	}
+
+	if !s.Type.IsStruct() {
+		return nil, pkg.WithPos(fmt.Errorf("cannot use struct literal for non-struct type %s", s.Type.String()), s.Scope.Current().File, s.Pos)
+	}
+
+	irType, err := s.Type.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	st := s.Type.Struct()
+
+	// unmentioned fields stay nil and are zero-filled
+	values := make([]value.Value, len(st.Fields))
+	allConstant := true
+
+	for _, f := range s.Fields {
+		index, field, err := st.FindField(f.Ident)
+		if err != nil {
+			return nil, pkg.WithPos(err, s.Scope.Current().File, f.Pos)
+		}
+
+		if values[index] != nil {
+			return nil, pkg.WithPos(fmt.Errorf("field '%s' initialized twice", f.Ident), s.Scope.Current().File, f.Pos)
+		}
+
+		v, err := valueAs(s.Scope, f.Pos, f.Expr, field.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		if !v.Type.Equals(field.Type) {
+			return nil, pkg.WithPos(fmt.Errorf("cannot use %s as %s in field '%s'", v.Type.String(), field.Type.String(), f.Ident), s.Scope.Current().File, f.Pos)
+		}
+
+		if _, ok := v.Value.(constant.Constant); !ok {
+			allConstant = false
+		}
+
+		values[index] = v.Value
+	}
+
+	// a literal made of constants is a constant itself, so it can be used to initialize globals
+	if allConstant {
+		fields := make([]constant.Constant, len(values))
+		for i, v := range values {
+			if v == nil {
+				fieldIRType, err := st.Fields[i].Type.IRType()
+				if err != nil {
+					return nil, err
+				}
+
+				v = constant.NewZeroInitializer(fieldIRType)
+			}
+
+			fields[i] = v.(constant.Constant)
+		}
+
+		return &Value{
+			Type:  s.Type,
+			Value: constant.NewStruct(irType.(*types.StructType), fields...),
+		}, nil
+	}
+
+	var agg value.Value = constant.NewZeroInitializer(irType)
+	for i, v := range values {
+		if v != nil {
+			agg = s.Scope.BasicBlock().NewInsertValue(agg, v, uint64(i))
+		}
+	}
+
+	return &Value{
+		Type:  s.Type,
+		Value: agg,
+	}, nil
+}
+
+func (a *ArrayLiteralOp) String() string {
+	return "{" + ExpressionLikeList(a.Elems).String() + "}"
+}
+
+func (a *ArrayLiteralOp) Value() (*Value, error) {
+	return nil, pkg.WithPos(fmt.Errorf("cannot infer the type of array literal %s", a.String()), a.Scope.Current().File, a.Pos)
+}
+
+// ValueFor builds an array of the expected type, elements that are not listed are zero-filled.
+func (a *ArrayLiteralOp) ValueFor(expected *Type) (*Value, error) {
+	if !expected.IsArray() {
+		return nil, pkg.WithPos(fmt.Errorf("cannot use array literal as %s", expected.String()), a.Scope.Current().File, a.Pos)
+	}
+
+	// resolves the length of the array
+	irType, err := expected.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	at := expected.Array()
+	if len(a.Elems) > at.Len {
+		return nil, pkg.WithPos(fmt.Errorf("too many elements in array literal for %s: %d", expected.String(), len(a.Elems)), a.Scope.Current().File, a.Pos)
+	}
+
+	elemIRType, err := at.Type.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]value.Value, 0, len(a.Elems))
+	allConstant := true
+
+	for i, e := range a.Elems {
+		v, err := valueAs(a.Scope, a.Pos, e, at.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		if !v.Type.Equals(at.Type) {
+			return nil, pkg.WithPos(fmt.Errorf("cannot use %s as %s in array element %d", v.Type.String(), at.Type.String(), i), a.Scope.Current().File, a.Pos)
+		}
+
+		if _, ok := v.Value.(constant.Constant); !ok {
+			allConstant = false
+		}
+
+		values = append(values, v.Value)
+	}
+
+	if allConstant {
+		elems := make([]constant.Constant, at.Len)
+		for i := range elems {
+			if i < len(values) {
+				elems[i] = values[i].(constant.Constant)
+			} else {
+				elems[i] = constant.NewZeroInitializer(elemIRType)
+			}
+		}
+
+		return &Value{
+			Type:  expected,
+			Value: constant.NewArray(irType.(*types.ArrayType), elems...),
+		}, nil
+	}
+
+	var agg value.Value = constant.NewZeroInitializer(irType)
+	for i, v := range values {
+		agg = a.Scope.BasicBlock().NewInsertValue(agg, v, uint64(i))
+	}
+
+	return &Value{
+		Type:  expected,
+		Value: agg,
+	}, nil
+}
+
 func (f *FnCallOp) String() string {
+	if f.Expr != nil {
+		return fmt.Sprintf("%s(%s)", f.Expr.String(), ExpressionLikeList(f.Args).String())
+	}
+
 	return fmt.Sprintf("%s(%s)", f.Ident, ExpressionLikeList(f.Args).String())
 }
 
 func (f *FnCallOp) Value() (*Value, error) {
-	fn := f.Scope.FindFunction(f.Ident)
+	// a variable of function type shadows a function with the same name
+	if f.Expr == nil && f.Scope.FindVariable(f.Ident) == nil {
+		fn := f.Scope.FindFunction(f.Ident)
 
-	if fn == nil {
-		return nil, pkg.WithPos(fmt.Errorf("function %s not found", f.Ident), f.Scope.Current().File, f.Pos)
+		if fn == nil {
+			return nil, pkg.WithPos(fmt.Errorf("function %s not found", f.Ident), f.Scope.Current().File, f.Pos)
+		}
+
+		fn, err := fn.instance(f.Scope, f.Pos, f.TypeArgs, f.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		// e.g. called by a lambda initializing a global, before the signatures are declared
+		if fn.Ptr == nil {
+			if err := fn.Declare(); err != nil {
+				return nil, err
+			}
+		}
+
+		names := make([]string, 0, len(fn.Params))
+		for _, p := range fn.Params {
+			names = append(names, "'"+p.Ident+"'")
+		}
+
+		return f.call(fn.Name, fn.Type().Func(), names, fn.Ptr)
+	}
+
+	if ao, ok := f.Expr.(*AccessorOp); ok {
+		if v, ok, err := f.methodCall(ao); ok {
+			return v, err
+		}
+	}
+
+	callee := f.Expr
+	if callee == nil {
+		callee = &LoadOp{Name: f.Ident, Scope: f.Scope, Pos: f.Pos}
+	}
+
+	v, err := callee.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	name := f.Ident
+	if f.Expr != nil {
+		name = f.Expr.String()
+	}
+
+	if !v.Type.IsFunc() {
+		return nil, pkg.WithPos(fmt.Errorf("cannot call %s of type %s", sourceString(callee), v.Type.String()), f.Scope.Current().File, f.Pos)
+	}
+
+	ft := v.Type.Func()
+
+	if ft.Closure {
+		return f.closureCall(name, v)
+	}
+
+	names := make([]string, 0, len(ft.Params))
+	for i := range ft.Params {
+		names = append(names, strconv.Itoa(i+1))
+	}
+
+	return f.call(name, ft, names, v.Value)
+}
+
+// call checks the arguments against the signature and emits the call to callee.
+func (f *FnCallOp) call(name string, ft *FuncType, names []string, callee value.Value) (*Value, error) {
+	// arguments passed implicitly, e.g. the receiver of a method, are not counted in the diagnostics
+	hidden := 0
+	for hidden < len(f.Args) {
+		if _, ok := f.Args[hidden].(*valueOp); !ok {
+			break
+		}
+
+		hidden++
+	}
+
+	if len(f.Args) < len(ft.Params) {
+		return nil, pkg.WithPos(fmt.Errorf("not enough arguments in call to %s: expected %d, got %d", name, len(ft.Params)-hidden, len(f.Args)-hidden), f.Scope.Current().File, f.Pos)
+	}
+
+	if len(f.Args) > len(ft.Params) && !ft.Variadic {
+		return nil, pkg.WithPos(fmt.Errorf("too many arguments in call to %s: expected %d, got %d", name, len(ft.Params)-hidden, len(f.Args)-hidden), f.Scope.Current().File, f.Pos)
 	}
 
 	values := []value.Value{}
-	for _, arg := range f.Args {
-		v, err := arg.Value()
+	for i, arg := range f.Args {
+		var expected *Type
+		if i < len(ft.Params) {
+			expected = ft.Params[i]
+		}
 
+		v, err := valueAs(f.Scope, f.Pos, arg, expected)
 		if err != nil {
 			return nil, err
 		}
 
+		if i < len(ft.Params) {
+			if !v.Type.Equals(ft.Params[i]) {
+				return nil, pkg.WithPos(fmt.Errorf("cannot use %s as %s in argument %s of %s", v.Type.String(), ft.Params[i].String(), names[i], name), f.Scope.Current().File, f.Pos)
+			}
+		} else {
+			v, err = f.promote(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		values = append(values, v.Value)
 	}
 
-	ret := f.Scope.BasicBlock().NewCall(fn.Ptr, values...)
+	sig, err := lowerSignature(ft.Params, ft.Variadic, ft.ReturnType)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Value{
-		Type:  fn.ReturnType,
-		Value: ret,
+		Type:  ft.ReturnType,
+		Value: sig.emitCall(f.Scope.BasicBlock(), callee, values),
 	}, nil
 }
 
+// promote applies the C default argument promotions to a value passed as a variadic argument.
+func (f *FnCallOp) promote(v *Value) (*Value, error) {
+	if !v.Type.IsBasic() {
+		return v, nil
+	}
+
+	bb := f.Scope.BasicBlock()
+
+	switch {
+	case v.Type.IsVoid():
+		return nil, pkg.WithPos(fmt.Errorf("cannot use void as argument of %s", f.Ident), f.Scope.Current().File, f.Pos)
+	case v.Type.IsBool(), v.Type.IsUInt() && v.Type.BasicSize() < 32:
+		return &Value{
+			Type:  NewTypeBasic(f.Scope, f.Pos, BasicTypeI32),
+			Value: bb.NewZExt(v.Value, NewLLTypeInt(32)),
+		}, nil
+	case v.Type.IsInt() && v.Type.BasicSize() < 32:
+		return &Value{
+			Type:  NewTypeBasic(f.Scope, f.Pos, BasicTypeI32),
+			Value: bb.NewSExt(v.Value, NewLLTypeInt(32)),
+		}, nil
+	case v.Type.IsFloat() && v.Type.BasicSize() < 64:
+		return &Value{
+			Type:  NewTypeBasic(f.Scope, f.Pos, BasicTypeF64),
+			Value: bb.NewFPExt(v.Value, NewLLTypeFloat(64)),
+		}, nil
+	}
+
+	return v, nil
+}
+
 func (s *SizeOfOp) String() string {
 	return "sizeof(" + s.Expr.String() + ")"
 }
 
 func (s *SizeOfOp) Value() (*Value, error) {
-	bb := s.Scope.BasicBlock()
+	typ := s.Type
+	expr := s.Expr
 
-	var irType types.Type
+	// sizeof(x) is parsed as a type, but x can be a variable as well
+	if typ != nil && typ.IsAlias() && s.Scope.FindTypeDefByAlias(typ.Alias()) == nil && s.Scope.FindVariable(typ.Alias()) != nil {
+		typ = nil
+		expr = &LoadOp{Name: s.Type.Alias(), Scope: s.Scope, Pos: s.Pos}
+	}
 
-	if s.Type != nil {
-		var err error
-		irType, err = s.Type.IRType()
-		if err != nil {
-			return nil, err
-		}
-	} else if s.Expr != nil {
-		expr, err := s.Expr.Value()
+	if typ == nil && expr != nil {
+		expr, err := expr.Value()
 		if err != nil {
 			return nil, err
 		}
 
-		irType, err = expr.Type.IRType()
-		if err != nil {
-			return nil, err
-		}
-	} else {
+		typ = expr.Type
+	}
+
+	if typ == nil {
 		return nil, pkg.WithPos(fmt.Errorf("sizeof() needs either an expression or a type"), s.Scope.Current().File, s.Pos)
 	}
 
-	size := bb.NewGetElementPtr(
-		irType,
-		constant.NewNull(types.NewPointer(irType)),
-		NewLLInt(32, 1),
-	)
-	sizeInt := bb.NewPtrToInt(size, NewLLTypeInt(64))
+	if _, err := typ.IRType(); err != nil {
+		return nil, err
+	}
+
+	// the size is known at compile time, so sizeof can be used in constant expressions
+	size, _, err := typ.Layout()
+	if err != nil {
+		return nil, err
+	}
 
 	return &Value{
 		Type:  NewTypeBasic(s.Scope, s.Pos, BasicTypeI64),
-		Value: sizeInt,
+		Value: NewLLInt(64, size),
 	}, nil
 }
 
+// loadPattern matches the loads of variables in the String of an expression.
+var loadPattern = regexp.MustCompile(`load\((\w+)\)`)
+
+// sourceString returns expr as it is written in the source, for diagnostics.
+func sourceString(expr ExpressionLike) string {
+	return loadPattern.ReplaceAllString(expr.String(), "$1")
+}
+
 func (l *LoadOp) String() string {
 	return "load(" + l.Name + ")"
 }
@@ -656,9 +1467,38 @@ func (l *LoadOp) String() string {
 func (l *LoadOp) Value() (*Value, error) {
 	v := l.Scope.FindVariable(l.Name)
 	if v == nil {
+		// functions can be used as values of their function type
+		if fn := l.Scope.FindFunction(l.Name); fn != nil {
+			if fn.IsGeneric() {
+				return nil, pkg.WithPos(fmt.Errorf("cannot use generic function %s without calling it", fn.Name), l.Scope.Current().File, l.Pos)
+			}
+
+			// e.g. a global initialized with a function declared later
+			if fn.Ptr == nil {
+				if err := fn.Declare(); err != nil {
+					return nil, err
+				}
+			}
+
+			return &Value{
+				Type:  fn.Type(),
+				Value: fn.Ptr,
+			}, nil
+		}
+
 		return nil, pkg.WithPos(fmt.Errorf("variable %s not found", l.Name), l.Scope.Current().File, l.Pos)
 	}
 
+	// constants are folded into the expression instead of being loaded
+	if v.Constant != nil {
+		return &Value{
+			Type:  v.Type,
+			Ptr:   v.Ptr,
+			Value: v.Constant,
+			Const: true,
+		}, nil
+	}
+
 	irType, err := v.Type.IRType()
 	if err != nil {
 		return nil, err
@@ -670,6 +1510,7 @@ func (l *LoadOp) Value() (*Value, error) {
 		Type:  v.Type,
 		Ptr:   v.Ptr,
 		Value: inst,
+		Const: v.IsConst,
 	}, nil
 }
 
@@ -695,59 +1536,203 @@ func (c *ConstantNumberOp) String() string {
 }
 
 func (c *ConstantNumberOp) Value() (*Value, error) {
-	negative := false
-	if c.Sign == "-" {
-		negative = true
-	}
+	return c.ValueFor(nil)
+}
 
-	// try to parse it as an integer first
-	i, err := strconv.ParseInt(c.Constant, 10, 64)
+// ValueFor types the literal: a suffix decides the type, otherwise an untyped literal adopts
+// the expected integer or floating point type, and defaults to i64 or f64.
+func (c *ConstantNumberOp) ValueFor(expected *Type) (*Value, error) {
+	n, err := c.parse()
 	if err != nil {
-		// if failed, try to parse it as a float
-		f, err := strconv.ParseFloat(c.Constant, 64)
-		if err != nil {
-			return nil, pkg.WithPos(fmt.Errorf("can't parse number"), c.Scope.Current().File, c.Pos)
+		return nil, pkg.WithPos(err, c.Scope.Current().File, c.Pos)
+	}
+
+	return n.typed(c.Scope, c.Pos, c.String(), expected)
+}
+
+// typed gives the number its type and reports an overflow if it doesn't fit, expr is the
+// literal or constant expression the number comes from.
+func (n *number) typed(scope ScopeLike, pos lexer.Position, expr string, expected *Type) (*Value, error) {
+	var typ *Type
+	switch {
+	case n.suffix != "":
+		typ = NewTypeBasic(scope, pos, n.suffix)
+	case expected != nil && n.int != nil && (expected.IsInt() || expected.IsUInt()):
+		typ = expected
+	case expected != nil && expected.IsFloat():
+		typ = expected
+	case n.int != nil:
+		typ = NewTypeBasic(scope, pos, BasicTypeI64)
+	default:
+		typ = NewTypeBasic(scope, pos, BasicTypeF64)
+	}
+
+	overflow := pkg.WithPos(fmt.Errorf("constant %s overflows %s", expr, typ.String()), scope.Current().File, pos)
+
+	if typ.IsFloat() {
+		f := n.float
+		if n.int != nil {
+			f, _ = new(big.Float).SetInt(n.int).Float64()
 		}
 
-		if negative {
-			f = -f
+		if math.IsInf(f, 0) || (typ.Basic() == BasicTypeF32 && math.Abs(f) > math.MaxFloat32) {
+			return nil, overflow
 		}
 
 		return &Value{
-			Type:  NewTypeBasic(c.Scope, c.Pos, BasicTypeF64),
-			Value: NewLLFloat(64, f),
+			Type:  typ,
+			Value: newFoldedFloat(typ.LLVMFloatType(), f),
 		}, nil
 	}
 
-	if negative {
-		i = -i
+	bits := typ.LLVMIntType().BitSize
+	min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if typ.IsInt() {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+
+	if n.int.Cmp(min) < 0 || n.int.Cmp(max) >= 0 {
+		return nil, overflow
 	}
 
 	return &Value{
-		Type:  NewTypeBasic(c.Scope, c.Pos, BasicTypeI64),
-		Value: NewLLInt(64, int(i)),
+		Type:  typ,
+		Value: newFoldedInt(typ.LLVMIntType(), n.int),
 	}, nil
 }
 
+// IsUntyped reports whether the literal has no suffix, so its type comes from the context.
+func (c *ConstantNumberOp) IsUntyped() bool {
+	n, err := c.parse()
+	return err == nil && n.suffix == ""
+}
+
+// number is a parsed numeric literal. The value is exact until the literal gets its type.
+type number struct {
+	int    *big.Int // nil for floating point literals
+	float  float64
+	suffix BasicType
+}
+
+func (c *ConstantNumberOp) parse() (*number, error) {
+	s := strings.ReplaceAll(c.Constant, "_", "")
+	n := &number{}
+
+	// hex digits include f, so a hex literal can only have an integer suffix
+	prefixed := len(s) > 2 && s[0] == '0' && strings.ContainsRune("xXoObB", rune(s[1]))
+	suffixes := "iuf"
+	if prefixed {
+		suffixes = "iu"
+	}
+
+	if i := strings.IndexAny(s, suffixes); i > 0 {
+		n.suffix = BasicType(s[i:])
+		s = s[:i]
+
+		switch n.suffix {
+		case BasicTypeI8, BasicTypeI16, BasicTypeI32, BasicTypeI64,
+			BasicTypeUI8, BasicTypeUI16, BasicTypeUI32, BasicTypeUI64,
+			BasicTypeF32, BasicTypeF64:
+		default:
+			return nil, fmt.Errorf("invalid suffix %s in number %s", n.suffix, c.Constant)
+		}
+	}
+
+	isFloat := !prefixed && strings.ContainsAny(s, ".eE")
+	if isFloat && n.suffix != "" && n.suffix != BasicTypeF32 && n.suffix != BasicTypeF64 {
+		return nil, fmt.Errorf("invalid suffix %s for floating point number %s", n.suffix, c.Constant)
+	}
+
+	if isFloat || n.suffix == BasicTypeF32 || n.suffix == BasicTypeF64 {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("can't parse number")
+		}
+
+		if c.Sign == "-" {
+			f = -f
+		}
+
+		n.float = f
+
+		return n, nil
+	}
+
+	// a leading zero doesn't make a literal octal, only the 0o prefix does
+	base := 10
+	if prefixed {
+		base = 0
+	}
+
+	x, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		return nil, fmt.Errorf("can't parse number")
+	}
+
+	if c.Sign == "-" {
+		x.Neg(x)
+	}
+
+	n.int = x
+
+	return n, nil
+}
+
 func (c *ConstantNullOp) String() string {
 	return "NULL"
 }
 
+// Value returns a void* null pointer, which converts to any pointer type.
 func (c *ConstantNullOp) Value() (*Value, error) {
 	return &Value{
-		Type:  NewTypeBasic(c.Scope, c.Pos, BasicTypeI8).NewPointer(),
+		Type:  NewTypeBasic(c.Scope, c.Pos, BasicTypeVoid).NewPointer(),
 		Value: NewNullPtr(),
 	}, nil
 }
 
+// ValueFor returns a null pointer of the expected pointer or function type.
+func (c *ConstantNullOp) ValueFor(expected *Type) (*Value, error) {
+	if !expected.IsPointer() && !expected.IsFunc() {
+		return c.Value()
+	}
+
+	irType, err := expected.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	// a null closure has no function and no environment
+	if expected.IsClosure() {
+		return &Value{
+			Type:  expected,
+			Value: constant.NewZeroInitializer(irType),
+		}, nil
+	}
+
+	return &Value{
+		Type:  expected,
+		Value: constant.NewNull(irType.(*types.PointerType)),
+	}, nil
+}
+
 func (c *ConstantCharOp) String() string {
 	return `'` + c.Constant + `'`
 }
 
 func (c *ConstantCharOp) Value() (*Value, error) {
+	s, err := unescape(c.Constant)
+	if err != nil {
+		return nil, pkg.WithPos(err, c.Scope.Current().File, escapePos(c.Pos, c.Constant, err))
+	}
+
+	if len(s) != 1 {
+		return nil, pkg.WithPos(fmt.Errorf("character literal %s must be a single byte", c.String()), c.Scope.Current().File, c.Pos)
+	}
+
 	return &Value{
 		Type:  NewTypeBasic(c.Scope, c.Pos, BasicTypeI8),
-		Value: NewLLInt(8, int(c.Constant[0])),
+		Value: newFoldedInt(NewLLTypeInt(8), big.NewInt(int64(s[0]))),
 	}, nil
 }
 
@@ -756,12 +1741,17 @@ func (c *ConstantStringOp) String() string {
 }
 
 func (c *ConstantStringOp) Value() (*Value, error) {
+	s, err := unescape(c.Constant)
+	if err != nil {
+		return nil, pkg.WithPos(err, c.Scope.Current().File, escapePos(c.Pos, c.Constant, err))
+	}
+
 	m := c.Scope.CurrentModule()
 	id := m.GenerateID("id")
-	ptr := m.Ptr.NewGlobalDef(id, constant.NewCharArrayFromString(c.Constant+"\x00"))
+	ptr := m.Ptr.NewGlobalDef(id, constant.NewCharArrayFromString(s+"\x00"))
 
 	return &Value{
 		Type:  NewTypeBasic(c.Scope, c.Pos, BasicTypeI8).NewPointer(),
-		Value: c.Scope.BasicBlock().NewBitCast(ptr, types.NewPointer(NewLLTypeInt(8))),
+		Value: constant.NewBitCast(ptr, types.NewPointer(NewLLTypeInt(8))),
 	}, nil
 }
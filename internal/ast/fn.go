@@ -2,8 +2,13 @@ package ast
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/Astemirdum/si/pkg"
 
 	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
 )
 
 func (f *Function) String() []string {
@@ -25,7 +30,12 @@ func (f *Function) String() []string {
 		suffix = ";"
 	}
 
-	line := fmt.Sprintf("%s %s(%s) -> %s%s", prefix, f.Name, params, f.ReturnType.String(), suffix)
+	name := f.Name
+	if f.IsGeneric() {
+		name += "<" + strings.Join(f.TypeParams, ", ") + ">"
+	}
+
+	line := fmt.Sprintf("%s%s %s(%s) -> %s%s", exportPrefix(f.Exported), prefix, name, params, f.ReturnType.String(), suffix)
 
 	lines = append(lines, line)
 
@@ -86,7 +96,14 @@ func (f *Function) FindVariable(ident string) *Variable {
 	}
 
 	// if cannot find variable in current scope, search in parent scope
-	return f.Scope.Parent.FindVariable(ident)
+	v := f.Scope.Parent.FindVariable(ident)
+
+	// a lambda uses the locals of the enclosing functions through its environment
+	if f.env != nil && v != nil && isLocal(v) {
+		return f.env.capture(v)
+	}
+
+	return v
 }
 
 func (f *Function) FindFunction(ident string) *Function {
@@ -109,31 +126,122 @@ func (f *Function) SetBasicBlock(block *ir.Block) {
 	f.CurrentModule().SetBasicBlock(block)
 }
 
-func (f *Function) Generate() error {
-	m := f.CurrentModule()
+// LoopTarget is a statement that break and continue can jump out of.
+type LoopTarget struct {
+	Label    string
+	Break    *ir.Block
+	Continue *ir.Block
+}
+
+func (f *Function) PushLoop(target *LoopTarget) error {
+	if target.Label != "" {
+		for _, l := range f.Loops {
+			if l.Label == target.Label {
+				return fmt.Errorf("label '%s' already defined", target.Label)
+			}
+		}
+	}
+
+	f.Loops = append(f.Loops, target)
+
+	return nil
+}
 
-	params := []*ir.Param{}
+func (f *Function) PopLoop() {
+	f.Loops = f.Loops[:len(f.Loops)-1]
+}
 
+// FindLoop returns the innermost target with the given label (any target if label is empty).
+// If continuable is set, only targets that can be continued are considered.
+func (f *Function) FindLoop(label string, continuable bool) (*LoopTarget, error) {
+	for i := len(f.Loops) - 1; i >= 0; i-- {
+		l := f.Loops[i]
+
+		if label != "" && l.Label != label {
+			continue
+		}
+
+		if continuable && l.Continue == nil {
+			if label != "" {
+				return nil, fmt.Errorf("cannot continue '%s', it is not a loop", label)
+			}
+
+			continue
+		}
+
+		return l, nil
+	}
+
+	if label != "" {
+		return nil, fmt.Errorf("unknown label '%s'", label)
+	}
+
+	return nil, fmt.Errorf("not inside a loop")
+}
+
+// Type returns the function type of f, used when f is taken as a value.
+func (f *Function) Type() *Type {
+	params := make([]*Type, 0, len(f.Params))
 	for _, p := range f.Params {
-		typ, err := p.Type.IRType()
-		if err != nil {
+		params = append(params, p.Type)
+	}
+
+	return NewTypeFunc(f, f.Pos, params, f.Variadic, f.ReturnType)
+}
+
+// Declare adds the function signature to the module, so that it can be called before its body is generated.
+func (f *Function) Declare() error {
+	if f.Receiver != "" {
+		if err := f.checkReceiver(); err != nil {
 			return err
 		}
-
-		params = append(params, ir.NewParam(p.Ident, typ))
 	}
 
-	typ, err := f.ReturnType.IRType()
+	m := f.CurrentModule()
+	name := m.symbol(f.Name, f.Exported || f.OnlyDeclare)
+
+	ft := f.Type().Func()
+
+	sig, err := lowerSignature(ft.Params, ft.Variadic, ft.ReturnType)
 	if err != nil {
 		return err
 	}
 
-	f.Ptr = m.Ptr.NewFunc(f.Name, typ, params...)
+	for _, el := range m.Ptr.Funcs {
+		if el.Name() != name {
+			continue
+		}
+
+		// every file can declare the external functions it uses, e.g. printf
+		if f.OnlyDeclare && el.Sig.Equal(sig.Sig) {
+			f.abi = sig
+			f.Ptr = el
+
+			return nil
+		}
+
+		return pkg.WithPos(fmt.Errorf("function '%s' already exists", f.Name), f.Scope.File, f.Pos)
+	}
+
+	f.abi = sig
+	f.Ptr = m.Ptr.NewFunc(name, sig.Sig.RetType, sig.declare(f)...)
 
 	if f.Variadic {
 		f.Ptr.Sig.Variadic = true
 	}
 
+	if name != f.Name {
+		f.Ptr.Linkage = enum.LinkageInternal
+	}
+
+	if sig.Ret != nil {
+		f.Ptr.ReturnAttrs = sig.Ret.returnAttrs()
+	}
+
+	return nil
+}
+
+func (f *Function) Generate() error {
 	if f.OnlyDeclare {
 		return nil
 	}
@@ -143,15 +251,10 @@ func (f *Function) Generate() error {
 	f.SetBasicBlock(entry)
 
 	// initialize params
-	for i, p := range f.Params {
-		typ, err := p.Type.IRType()
-		if err != nil {
-			return err
-		}
+	f.abi.storeParams(f)
 
-		ptr := f.BasicBlock().NewAlloca(typ)
-		f.BasicBlock().NewStore(f.Ptr.Params[i], ptr)
-		p.Ptr = ptr
+	if f.env != nil {
+		f.env.prologue(f)
 	}
 
 	for _, stmt := range f.Body {
@@ -160,27 +263,64 @@ func (f *Function) Generate() error {
 		}
 	}
 
-	returnIRType, err := f.ReturnType.IRType()
-	if err != nil {
-		return err
+	return f.terminate()
+}
+
+// terminate ends the blocks the body left open. Every return is checked by ReturnStmt, so only
+// falling off the end is left: a void function returns, a block that can't be reached, e.g. after
+// an if whose branches both return, is unreachable, any other function is missing a return.
+func (f *Function) terminate() error {
+	blocks := f.Ptr.Blocks
+
+	// the entry of a lambda jumps to its body once the captures are known
+	if f.env != nil {
+		blocks = blocks[1:]
 	}
 
-	if ret, ok := f.BasicBlock().Term.(*ir.TermRet); ok {
-		// X is nil, if return expression is void (NewRet was call with nil)
-		if ret.X != nil {
-			if f.ReturnType.IsVoid() {
-				return fmt.Errorf("function '%s' must not return a value", f.Name)
-			}
+	reachable := map[*ir.Block]bool{}
+	queue := []*ir.Block{blocks[0]}
 
-			if !ret.X.Type().Equal(returnIRType) {
-				return fmt.Errorf("function '%s' must return a value of type '%s'", f.Name, f.ReturnType.String())
-			}
-		} else {
-			if !f.ReturnType.IsVoid() {
-				return fmt.Errorf("function '%s' must return a value of type '%s'", f.Name, f.ReturnType.String())
-			}
+	for len(queue) > 0 {
+		b := queue[0]
+		queue = queue[1:]
+
+		if reachable[b] {
+			continue
+		}
+
+		reachable[b] = true
+
+		if b.Term != nil {
+			queue = append(queue, successors(b.Term)...)
+		}
+	}
+
+	for _, b := range blocks {
+		switch {
+		case b.Term != nil:
+		case !reachable[b]:
+			b.NewUnreachable()
+		case f.ReturnType.IsVoid():
+			b.NewRet(nil)
+		default:
+			return pkg.WithPos(fmt.Errorf("missing return at the end of function '%s'", f.Name), f.Scope.File, f.Pos)
 		}
 	}
 
 	return nil
 }
+
+// successors returns the blocks term can jump to, a branch on a constant only jumps to one, e.g. while (true).
+func successors(term ir.Terminator) []*ir.Block {
+	if br, ok := term.(*ir.TermCondBr); ok {
+		if c, ok := br.Cond.(*constant.Int); ok {
+			if c.X.Sign() != 0 {
+				return []*ir.Block{br.TargetTrue.(*ir.Block)}
+			}
+
+			return []*ir.Block{br.TargetFalse.(*ir.Block)}
+		}
+	}
+
+	return term.Succs()
+}
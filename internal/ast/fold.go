@@ -0,0 +1,431 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+
+	"github.com/Astemirdum/si/pkg"
+)
+
+// Constant folding: operations on constant operands produce constants instead of instructions,
+// so that constant expressions can be used where LLVM or the language requires a constant,
+// e.g. global initializers, case labels and array lengths.
+
+// evalConstant evaluates expr in a detached block, so nothing is emitted into the current function,
+// and reports whether the result is a constant.
+func evalConstant(scope ScopeLike, pos lexer.Position, expr ExpressionLike, expected *Type) (*Value, bool, error) {
+	m := scope.CurrentModule()
+
+	prev := m.BasicBlock()
+	m.SetBasicBlock(ir.NewBlock(""))
+	defer m.SetBasicBlock(prev)
+
+	val, err := valueAs(scope, pos, expr, expected)
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, ok := val.Value.(constant.Constant)
+
+	return val, ok, nil
+}
+
+func isConstant(v value.Value) bool {
+	_, ok := v.(constant.Constant)
+	return ok
+}
+
+// signedInt returns the value of c interpreted as a signed or unsigned integer of its bit size.
+func signedInt(c *constant.Int, signed bool) *big.Int {
+	x := wrapInt(c.X, c.Typ.BitSize)
+
+	if !signed && x.Sign() < 0 {
+		x.Add(x, new(big.Int).Lsh(big.NewInt(1), uint(c.Typ.BitSize)))
+	}
+
+	return x
+}
+
+// wrapInt truncates x to bits and returns it in the two's complement signed representation.
+func wrapInt(x *big.Int, bits uint64) *big.Int {
+	mod := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+
+	r := new(big.Int).Mod(x, mod)
+	if r.Cmp(new(big.Int).Rsh(mod, 1)) >= 0 {
+		r.Sub(r, mod)
+	}
+
+	return r
+}
+
+func newFoldedInt(typ *types.IntType, x *big.Int) *constant.Int {
+	c := constant.NewInt(typ, 0)
+	c.X = wrapInt(x, typ.BitSize)
+
+	return c
+}
+
+func floatOf(c *constant.Float) float64 {
+	if c.NaN {
+		return math.NaN()
+	}
+
+	f, _ := c.X.Float64()
+
+	return f
+}
+
+func newFoldedFloat(typ *types.FloatType, f float64) *constant.Float {
+	if typ.Kind == types.FloatKindFloat {
+		f = float64(float32(f))
+	}
+
+	return constant.NewFloat(typ, f)
+}
+
+// foldBinary computes op on two constants of type typ. The result is nil if the operation
+// cannot be folded, in which case the caller reports it as not implemented.
+func foldBinary(op string, typ *Type, l, r value.Value) (value.Value, error) {
+	switch {
+	case typ.IsBool():
+		li, lok := l.(*constant.Int)
+		ri, rok := r.(*constant.Int)
+		if !lok || !rok {
+			return nil, nil
+		}
+
+		switch op {
+		case "==":
+			return NewLLBool(li.X.Cmp(ri.X) == 0), nil
+		case "!=":
+			return NewLLBool(li.X.Cmp(ri.X) != 0), nil
+		}
+	case typ.IsInt(), typ.IsUInt(), typ.IsEnum():
+		li, lok := l.(*constant.Int)
+		ri, rok := r.(*constant.Int)
+		if !lok || !rok {
+			return nil, nil
+		}
+
+		signed := !typ.IsUInt()
+		x, y := signedInt(li, signed), signedInt(ri, signed)
+
+		switch op {
+		case "==":
+			return NewLLBool(x.Cmp(y) == 0), nil
+		case "!=":
+			return NewLLBool(x.Cmp(y) != 0), nil
+		case "<":
+			return NewLLBool(x.Cmp(y) < 0), nil
+		case ">":
+			return NewLLBool(x.Cmp(y) > 0), nil
+		case "<=":
+			return NewLLBool(x.Cmp(y) <= 0), nil
+		case ">=":
+			return NewLLBool(x.Cmp(y) >= 0), nil
+		}
+
+		// enums can only be compared
+		if typ.IsEnum() {
+			return nil, nil
+		}
+
+		z := new(big.Int)
+
+		switch op {
+		case "+":
+			z.Add(x, y)
+		case "-":
+			z.Sub(x, y)
+		case "*":
+			z.Mul(x, y)
+		case "/", "%":
+			if y.Sign() == 0 {
+				return nil, fmt.Errorf("division by zero in constant expression")
+			}
+
+			if op == "/" {
+				z.Quo(x, y)
+			} else {
+				z.Rem(x, y)
+			}
+		case "&":
+			z.And(x, y)
+		case "|":
+			z.Or(x, y)
+		case "^":
+			z.Xor(x, y)
+		case "<<", ">>":
+			if y.Sign() < 0 || y.Cmp(big.NewInt(int64(li.Typ.BitSize))) >= 0 {
+				return nil, fmt.Errorf("shift count %s out of range for %s", y.String(), typ.String())
+			}
+
+			if op == "<<" {
+				z.Lsh(x, uint(y.Uint64()))
+			} else {
+				z.Rsh(x, uint(y.Uint64()))
+			}
+		default:
+			return nil, nil
+		}
+
+		return newFoldedInt(li.Typ, z), nil
+	case typ.IsFloat():
+		lf, lok := l.(*constant.Float)
+		rf, rok := r.(*constant.Float)
+		if !lok || !rok {
+			return nil, nil
+		}
+
+		x, y := floatOf(lf), floatOf(rf)
+		// ordered comparisons, like the fcmp predicates used for non-constant operands
+		ordered := !math.IsNaN(x) && !math.IsNaN(y)
+
+		switch op {
+		case "==":
+			return NewLLBool(ordered && x == y), nil
+		case "!=":
+			return NewLLBool(ordered && x != y), nil
+		case "<":
+			return NewLLBool(ordered && x < y), nil
+		case ">":
+			return NewLLBool(ordered && x > y), nil
+		case "<=":
+			return NewLLBool(ordered && x <= y), nil
+		case ">=":
+			return NewLLBool(ordered && x >= y), nil
+		case "+":
+			return newFoldedFloat(lf.Typ, x+y), nil
+		case "-":
+			return newFoldedFloat(lf.Typ, x-y), nil
+		case "*":
+			return newFoldedFloat(lf.Typ, x*y), nil
+		case "/":
+			return newFoldedFloat(lf.Typ, x/y), nil
+		case "%":
+			return newFoldedFloat(lf.Typ, math.Mod(x, y)), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// untypedValue folds an expression of untyped number literals at full precision, then gives the
+// result the expected type, so that it overflows instead of wrapping around.
+func untypedValue(scope ScopeLike, pos lexer.Position, expr ExpressionLike, expected *Type) (*Value, error) {
+	// shift counts are checked against the integer type the result takes
+	typ := NewTypeBasic(scope, pos, BasicTypeI64)
+	if expected != nil && (expected.IsInt() || expected.IsUInt()) {
+		typ = expected
+	}
+
+	n, err := foldUntyped(expr, typ)
+	if err != nil {
+		return nil, pkg.WithPos(err, scope.Current().File, pos)
+	}
+
+	return n.typed(scope, pos, expr.String(), expected)
+}
+
+// foldUntyped computes an expression for which isUntyped holds. The result is an integer
+// if all literals are integers, otherwise a floating point number.
+func foldUntyped(expr ExpressionLike, typ *Type) (*number, error) {
+	switch e := expr.(type) {
+	case *ConstantNumberOp:
+		return e.parse()
+	case *UnaryOp:
+		x, err := foldUntyped(e.Expr, typ)
+		if err != nil {
+			return nil, err
+		}
+
+		if x.int != nil {
+			return &number{int: new(big.Int).Neg(x.int)}, nil
+		}
+
+		return &number{float: -x.float}, nil
+	case *BinaryOp:
+		x, err := foldUntyped(e.Left, typ)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := foldUntyped(e.Right, typ)
+		if err != nil {
+			return nil, err
+		}
+
+		if x.int != nil && y.int != nil {
+			return foldUntypedInt(e.Op, typ, x.int, y.int)
+		}
+
+		return foldUntypedFloat(e.Op, x.toFloat(), y.toFloat())
+	}
+
+	return nil, fmt.Errorf("%s is not a constant expression", expr.String())
+}
+
+func (n *number) toFloat() float64 {
+	if n.int == nil {
+		return n.float
+	}
+
+	f, _ := new(big.Float).SetInt(n.int).Float64()
+
+	return f
+}
+
+func foldUntypedInt(op string, typ *Type, x, y *big.Int) (*number, error) {
+	z := new(big.Int)
+
+	switch op {
+	case "+":
+		z.Add(x, y)
+	case "-":
+		z.Sub(x, y)
+	case "*":
+		z.Mul(x, y)
+	case "/", "%":
+		if y.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero in constant expression")
+		}
+
+		if op == "/" {
+			z.Quo(x, y)
+		} else {
+			z.Rem(x, y)
+		}
+	case "&":
+		z.And(x, y)
+	case "|":
+		z.Or(x, y)
+	case "^":
+		z.Xor(x, y)
+	case "<<", ">>":
+		if y.Sign() < 0 || y.Cmp(big.NewInt(int64(typ.LLVMIntType().BitSize))) >= 0 {
+			return nil, fmt.Errorf("shift count %s out of range for %s", y.String(), typ.String())
+		}
+
+		if op == "<<" {
+			z.Lsh(x, uint(y.Uint64()))
+		} else {
+			z.Rsh(x, uint(y.Uint64()))
+		}
+	default:
+		return nil, fmt.Errorf("operator %s is not defined on untyped integers", op)
+	}
+
+	return &number{int: z}, nil
+}
+
+func foldUntypedFloat(op string, x, y float64) (*number, error) {
+	switch op {
+	case "+":
+		return &number{float: x + y}, nil
+	case "-":
+		return &number{float: x - y}, nil
+	case "*":
+		return &number{float: x * y}, nil
+	case "/", "%":
+		if y == 0 {
+			return nil, fmt.Errorf("division by zero in constant expression")
+		}
+
+		if op == "/" {
+			return &number{float: x / y}, nil
+		}
+
+		return &number{float: math.Mod(x, y)}, nil
+	}
+
+	return nil, fmt.Errorf("operator %s is not defined on untyped floating point numbers", op)
+}
+
+// foldUnary computes - and ! on a constant, the result is nil if it cannot be folded.
+func foldUnary(op string, typ *Type, v value.Value) value.Value {
+	switch c := v.(type) {
+	case *constant.Int:
+		if op == "-" && (typ.IsInt() || typ.IsUInt()) {
+			return newFoldedInt(c.Typ, new(big.Int).Neg(c.X))
+		}
+
+		if op == "!" && typ.IsBool() {
+			return NewLLBool(c.X.Sign() == 0)
+		}
+	case *constant.Float:
+		if op == "-" {
+			return newFoldedFloat(c.Typ, -floatOf(c))
+		}
+	}
+
+	return nil
+}
+
+// foldCast converts a constant between basic numeric types, the result is nil if it cannot be folded.
+func foldCast(v *Value, typ *Type, target types.Type) value.Value {
+	switch c := v.Value.(type) {
+	case *constant.Int:
+		if !v.Type.IsInt() && !v.Type.IsUInt() {
+			return nil
+		}
+
+		x := signedInt(c, v.Type.IsInt())
+
+		if typ.IsInt() || typ.IsUInt() {
+			return newFoldedInt(target.(*types.IntType), x)
+		}
+
+		if typ.IsFloat() {
+			f, _ := new(big.Float).SetInt(x).Float64()
+			return newFoldedFloat(target.(*types.FloatType), f)
+		}
+	case *constant.Float:
+		f := floatOf(c)
+
+		if typ.IsFloat() {
+			return newFoldedFloat(target.(*types.FloatType), f)
+		}
+
+		// out of range conversions are poison in LLVM, so they are left to the instruction
+		if (typ.IsInt() || typ.IsUInt()) && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			x, _ := big.NewFloat(math.Trunc(f)).Int(nil)
+			return newFoldedInt(target.(*types.IntType), x)
+		}
+	}
+
+	return nil
+}
+
+// resolve evaluates the length expression of an array type, once.
+func (at *ArrayType) resolve(scope ScopeLike, pos lexer.Position) error {
+	if at.LenExpr == nil {
+		return nil
+	}
+
+	val, ok, err := evalConstant(scope, pos, at.LenExpr, nil)
+	if err != nil {
+		return err
+	}
+
+	c, isInt := val.Value.(*constant.Int)
+	if !ok || !isInt || !(val.Type.IsInt() || val.Type.IsUInt()) {
+		return pkg.WithPos(fmt.Errorf("array length %s is not an integer constant", sourceString(at.LenExpr)), scope.Current().File, pos)
+	}
+
+	x := signedInt(c, val.Type.IsInt())
+	if !x.IsInt64() || x.Int64() > math.MaxInt32 {
+		return pkg.WithPos(fmt.Errorf("array length %s is too large", x.String()), scope.Current().File, pos)
+	}
+
+	at.Len = int(x.Int64())
+	at.LenExpr = nil
+
+	return nil
+}
@@ -0,0 +1,338 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/llir/llvm/ir"
+
+	"github.com/Astemirdum/si/pkg"
+)
+
+// Generics: generic functions and types are templates, which are transformed again for every list of
+// type arguments they are used with (monomorphization). An Instance scope binds the type parameters of
+// the transformed copy, and the parser replaces them by the type arguments with TypeArgument.
+
+// Instance is the scope of an instantiation of a generic function or type.
+type Instance struct {
+	Params []string
+	Args   []*Type
+
+	Scope *Scope
+}
+
+func newInstance(parent ScopeLike, params []string, args []*Type) *Instance {
+	return &Instance{
+		Params: params,
+		Args:   args,
+		Scope:  NewScopeFromParent(parent),
+	}
+}
+
+// TypeArgument returns the type bound to the type parameter name in scope, or nil if there is none.
+func TypeArgument(scope ScopeLike, name string) *Type {
+	for scope != nil && scope.Current() != nil {
+		if inst, ok := scope.(*Instance); ok {
+			for i, p := range inst.Params {
+				if p == name {
+					return inst.Args[i]
+				}
+			}
+		}
+
+		scope = scope.Current().Parent
+	}
+
+	return nil
+}
+
+func (i *Instance) Current() *Scope {
+	return i.Scope
+}
+
+func (i *Instance) AddModuleTypeDef(alias string, typ *Type) {
+	i.Scope.Parent.AddModuleTypeDef(alias, typ)
+}
+
+func (i *Instance) AddLocalType(alias string, typ *Type) {
+	i.Scope.Parent.AddLocalType(alias, typ)
+}
+
+func (i *Instance) AddGlobal(v *Variable) {
+	i.Scope.Parent.AddGlobal(v)
+}
+
+func (i *Instance) AddLocal(v *Variable) error {
+	return i.Scope.Parent.AddLocal(v)
+}
+
+func (i *Instance) FindTypeDefByAlias(alias string) *TypeDef {
+	return i.Scope.Parent.FindTypeDefByAlias(alias)
+}
+
+func (i *Instance) FindTypeDefByType(typ *Type) *TypeDef {
+	return i.Scope.Parent.FindTypeDefByType(typ)
+}
+
+func (i *Instance) FindVariable(ident string) *Variable {
+	return i.Scope.Parent.FindVariable(ident)
+}
+
+func (i *Instance) FindFunction(ident string) *Function {
+	return i.Scope.Parent.FindFunction(ident)
+}
+
+func (i *Instance) CurrentModule() *Module {
+	return i.Scope.Parent.CurrentModule()
+}
+
+func (i *Instance) CurrentFunction() *Function {
+	return i.Scope.Parent.CurrentFunction()
+}
+
+func (i *Instance) BasicBlock() *ir.Block {
+	return i.Scope.Parent.BasicBlock()
+}
+
+func (i *Instance) SetBasicBlock(b *ir.Block) {
+	i.Scope.Parent.SetBasicBlock(b)
+}
+
+// typeList is the key of an instantiation and the part of its name between the angle brackets.
+func typeList(args []*Type) string {
+	names := make([]string, 0, len(args))
+	for _, a := range args {
+		names = append(names, a.String())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func typeListEquals(a, b []*Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].Equals(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func checkTypeArgs(kind, name string, params []string, args []*Type) error {
+	if len(params) == 0 {
+		return fmt.Errorf("%s %s is not generic", kind, name)
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("generic %s %s needs type arguments", kind, name)
+	}
+
+	if len(args) != len(params) {
+		return fmt.Errorf("%s %s expects %d type arguments, got %d", kind, name, len(params), len(args))
+	}
+
+	return nil
+}
+
+// instance returns the definition of the generic type alias t with its type arguments.
+func (td *TypeDef) instance(t *Type) (*TypeDef, error) {
+	if err := checkTypeArgs("type", td.Alias, td.TypeParams, t._typeArgs); err != nil {
+		return nil, pkg.WithPos(err, t.Scope.Current().File, t.Pos)
+	}
+
+	key := typeList(t._typeArgs)
+	if inst, ok := td.instances[key]; ok {
+		return inst, nil
+	}
+
+	if td.instances == nil {
+		td.instances = map[string]*TypeDef{}
+	}
+
+	inst := &TypeDef{
+		Alias:    fmt.Sprintf("%s<%s>", td.Alias, key),
+		Exported: td.Exported,
+	}
+
+	scope := newInstance(td.Type.Scope, td.TypeParams, t._typeArgs)
+	if td.Bounds != nil {
+		if err := checkBounds(t.Scope, t.Pos, "type", td.Alias, td.TypeParams, td.Bounds(scope), t._typeArgs); err != nil {
+			return nil, err
+		}
+	}
+
+	// cached before the transformation, the type can refer to itself
+	td.instances[key] = inst
+	inst.Type = td.Instantiate(scope)
+
+	return inst, nil
+}
+
+// IsGeneric reports whether f is a template, which is not generated itself.
+func (f *Function) IsGeneric() bool {
+	return len(f.TypeParams) > 0
+}
+
+// instance returns the instance of f called with args, inferring the type arguments that are not given.
+// The instance is declared right away, its body is generated after the functions of the program.
+func (f *Function) instance(scope ScopeLike, pos lexer.Position, typeArgs []*Type, args []ExpressionLike) (*Function, error) {
+	if !f.IsGeneric() && len(typeArgs) == 0 {
+		return f, nil
+	}
+
+	if f.IsGeneric() && len(typeArgs) == 0 {
+		inferred, err := f.inferTypeArgs(scope, pos, args)
+		if err != nil {
+			return nil, err
+		}
+
+		typeArgs = inferred
+	}
+
+	if err := checkTypeArgs("function", f.Name, f.TypeParams, typeArgs); err != nil {
+		return nil, pkg.WithPos(err, scope.Current().File, pos)
+	}
+
+	key := typeList(typeArgs)
+	if inst, ok := f.instances[key]; ok {
+		return inst, nil
+	}
+
+	if f.instances == nil {
+		f.instances = map[string]*Function{}
+	}
+
+	instScope := newInstance(f.Scope.Parent, f.TypeParams, typeArgs)
+	if f.Bounds != nil {
+		if err := checkBounds(scope, pos, "function", f.Name, f.TypeParams, f.Bounds(instScope), typeArgs); err != nil {
+			return nil, err
+		}
+	}
+
+	inst := f.Instantiate(instScope)
+	inst.Name = fmt.Sprintf("%s<%s>", f.Name, key)
+	f.instances[key] = inst
+
+	if err := inst.Declare(); err != nil {
+		return nil, instantiationError(inst, err)
+	}
+
+	m := inst.CurrentModule().program()
+	m.pending = append(m.pending, inst)
+
+	return inst, nil
+}
+
+// instantiationError names the instance in an error found in the body of a generic function,
+// because the position only points into the template.
+func instantiationError(inst *Function, err error) error {
+	return fmt.Errorf("in instantiation %s: %w", inst.Name, err)
+}
+
+// inferTypeArgs infers the type arguments of a call from the types of its arguments. Untyped number
+// literals adopt the type of their parameter, so they only bind type parameters that are left.
+func (f *Function) inferTypeArgs(scope ScopeLike, pos lexer.Position, args []ExpressionLike) ([]*Type, error) {
+	bound := make([]*Type, len(f.TypeParams))
+
+	for _, untyped := range []bool{false, true} {
+		for i, arg := range args {
+			if i >= len(f.Params) || isUntyped(arg) != untyped {
+				continue
+			}
+
+			typ, err := staticType(scope, arg)
+			if err != nil {
+				return nil, err
+			}
+
+			target := bound
+			if untyped {
+				target = make([]*Type, len(bound))
+			}
+
+			if err := f.unify(f.Params[i].Type, typ, target); err != nil {
+				return nil, pkg.WithPos(err, scope.Current().File, pos)
+			}
+
+			for j := range target {
+				if bound[j] == nil {
+					bound[j] = target[j]
+				}
+			}
+		}
+	}
+
+	for i, b := range bound {
+		if b == nil {
+			return nil, pkg.WithPos(fmt.Errorf("cannot infer type parameter %s of %s", f.TypeParams[i], f.Name), scope.Current().File, pos)
+		}
+	}
+
+	return bound, nil
+}
+
+// unify binds the type parameters in the parameter type pattern to the matching parts of the argument type.
+// Parts that don't match are left to the call to report.
+func (f *Function) unify(pattern, typ *Type, bound []*Type) error {
+	switch {
+	case pattern._alias != "" && len(pattern._typeArgs) == 0:
+		for i, p := range f.TypeParams {
+			if p != pattern._alias {
+				continue
+			}
+
+			if bound[i] == nil {
+				bound[i] = typ
+			} else if !bound[i].Equals(typ) {
+				return fmt.Errorf("type parameter %s of %s is both %s and %s", p, f.Name, bound[i].String(), typ.String())
+			}
+		}
+	case pattern._alias != "":
+		if typ.IsAlias() && typ.Alias() == pattern._alias && len(typ._typeArgs) == len(pattern._typeArgs) {
+			for i, a := range pattern._typeArgs {
+				if err := f.unify(a, typ._typeArgs[i], bound); err != nil {
+					return err
+				}
+			}
+		}
+	case pattern._pointer != nil:
+		if typ.IsPointer() {
+			return f.unify(pattern._pointer, typ.Pointer(), bound)
+		}
+	case pattern._array != nil:
+		if typ.IsArray() {
+			return f.unify(pattern._array.Type, typ.Array().Type, bound)
+		}
+	case pattern._tuple != nil:
+		if typ.IsTuple() && len(typ.Tuple().Types) == len(pattern._tuple.Types) {
+			for i, p := range pattern._tuple.Types {
+				if err := f.unify(p, typ.Tuple().Types[i], bound); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// staticType returns the type of expr, evaluated in a detached block, so nothing is emitted.
+func staticType(scope ScopeLike, expr ExpressionLike) (*Type, error) {
+	m := scope.CurrentModule()
+
+	prev := m.BasicBlock()
+	m.SetBasicBlock(ir.NewBlock(""))
+	defer m.SetBasicBlock(prev)
+
+	val, err := expr.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	return val.Type, nil
+}
@@ -0,0 +1,90 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/Astemirdum/si/pkg"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+)
+
+func (g *Global) String() []string {
+	prefix := exportPrefix(g.Exported) + "global "
+
+	if g.Expr != nil {
+		return []string{prefix + g.Variable.String() + " = " + g.Expr.String() + ";"}
+	}
+
+	return []string{prefix + g.Variable.String() + ";"}
+}
+
+func (g *Global) Generate() error {
+	m := g.Scope.CurrentModule()
+	v := g.Variable
+	name := m.symbol(v.Ident, g.Exported)
+
+	for _, el := range m.Ptr.Globals {
+		if el.Name() == name {
+			return pkg.WithPos(fmt.Errorf("global variable '%s' already exists", v.Ident), g.Scope.Current().File, g.Pos)
+		}
+	}
+
+	typ, err := v.Type.IRType()
+	if err != nil {
+		return err
+	}
+
+	if v.Type.IsVoid() {
+		return pkg.WithPos(fmt.Errorf("global variable '%s' cannot be void", v.Ident), g.Scope.Current().File, g.Pos)
+	}
+
+	var init constant.Constant
+
+	if g.Expr != nil {
+		val, err := g.constantValue()
+		if err != nil {
+			return err
+		}
+
+		if !val.Type.Equals(v.Type) {
+			return pkg.WithPos(fmt.Errorf("cannot assign %s to %s", val.Type.String(), v.Type.String()), g.Scope.Current().File, g.Pos)
+		}
+
+		init = val.Value.(constant.Constant)
+	} else {
+		if v.IsConst {
+			return pkg.WithPos(fmt.Errorf("constant '%s' must be initialized", v.Ident), g.Scope.Current().File, g.Pos)
+		}
+
+		init = constant.NewZeroInitializer(typ)
+	}
+
+	ptr := m.Ptr.NewGlobalDef(name, init)
+	ptr.Immutable = v.IsConst
+
+	if name != v.Ident {
+		ptr.Linkage = enum.LinkageInternal
+	}
+	v.Ptr = ptr
+
+	if v.IsConst {
+		v.Constant = init
+	}
+
+	return nil
+}
+
+// constantValue evaluates the initializer of a global, which must be a constant expression.
+func (g *Global) constantValue() (*Value, error) {
+	val, ok, err := evalConstant(g.Scope, g.Pos, g.Expr, g.Variable.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, pkg.WithPos(fmt.Errorf("initializer of global '%s' is not a constant expression", g.Variable.Ident), g.Scope.Current().File, g.Pos)
+	}
+
+	return val, nil
+}
@@ -0,0 +1,306 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+
+	"github.com/Astemirdum/si/pkg"
+)
+
+// Interfaces: an interface lists method signatures, without the receiver. A named type implements it
+// if it has all of them. An interface value is a fat pointer: the address of the value and a vtable,
+// a global array with its methods in the order of the interface. A call through an interface loads
+// the method from the vtable and passes the address as the receiver (dynamic dispatch). As a bound of
+// a type parameter, e.g. T: Ordered<T>, the methods are called on the type argument itself (static dispatch).
+
+type InterfaceMethod struct {
+	Ident string
+	Func  *FuncType
+
+	Pos lexer.Position
+}
+
+type InterfaceType struct {
+	Methods []*InterfaceMethod
+}
+
+func NewTypeInterface(scope ScopeLike, pos lexer.Position, methods ...*InterfaceMethod) *Type {
+	return &Type{
+		_iface: &InterfaceType{
+			Methods: methods,
+		},
+		Scope: scope,
+		Pos:   pos,
+	}
+}
+
+// InterfaceIRType is the type of interface values: the data pointer and the vtable pointer.
+func InterfaceIRType() *types.StructType {
+	return types.NewStruct(types.I8Ptr, types.NewPointer(types.I8Ptr))
+}
+
+func (im *InterfaceMethod) String() string {
+	params := make([]string, 0, len(im.Func.Params))
+	for _, p := range im.Func.Params {
+		params = append(params, p.String())
+	}
+
+	return fmt.Sprintf("%s %s(%s)", im.Func.ReturnType.String(), im.Ident, strings.Join(params, ", "))
+}
+
+func (it *InterfaceType) String() string {
+	methods := make([]string, 0, len(it.Methods))
+	for _, m := range it.Methods {
+		methods = append(methods, m.String()+", ")
+	}
+
+	return fmt.Sprintf("interface { %s}", strings.Join(methods, ""))
+}
+
+func (it *InterfaceType) Equals(o *InterfaceType) bool {
+	if len(it.Methods) != len(o.Methods) {
+		return false
+	}
+
+	for i, m := range it.Methods {
+		if m.Ident != o.Methods[i].Ident || !m.Func.Equals(o.Methods[i].Func) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FindMethod returns the index of the method in the vtable.
+func (it *InterfaceType) FindMethod(ident string) (int, *InterfaceMethod) {
+	for i, m := range it.Methods {
+		if m.Ident == ident {
+			return i, m
+		}
+	}
+
+	return 0, nil
+}
+
+func (it *InterfaceType) check(scope ScopeLike) error {
+	for i, m := range it.Methods {
+		for _, o := range it.Methods[:i] {
+			if o.Ident == m.Ident {
+				return pkg.WithPos(fmt.Errorf("duplicate interface method '%s'", m.Ident), scope.Current().File, m.Pos)
+			}
+		}
+
+		for _, p := range m.Func.Params {
+			if p.IsVoid() {
+				return pkg.WithPos(fmt.Errorf("parameter of interface method %s cannot be void", m.Ident), scope.Current().File, m.Pos)
+			}
+		}
+	}
+
+	return nil
+}
+
+// implements returns the methods of typ in the order of the interface iface, or the reason it doesn't
+// implement it. An interface implements another one if it has all its methods.
+func implements(scope ScopeLike, typ, iface *Type) ([]*Function, error) {
+	if typ.IsInterface() {
+		for _, m := range iface.Interface().Methods {
+			_, own := typ.Interface().FindMethod(m.Ident)
+			if own == nil {
+				return nil, fmt.Errorf("missing method %s", m.Ident)
+			}
+
+			if !own.Func.Equals(m.Func) {
+				return nil, fmt.Errorf("method %s is %s, want %s", m.Ident, own.String(), m.String())
+			}
+		}
+
+		return nil, nil
+	}
+
+	if !typ.IsAlias() {
+		return nil, fmt.Errorf("only named types have methods")
+	}
+
+	methods := make([]*Function, 0, len(iface.Interface().Methods))
+
+	for _, m := range iface.Interface().Methods {
+		fn := scope.CurrentModule().FindMethod(typ.Alias(), m.Ident)
+		if fn == nil {
+			return nil, fmt.Errorf("missing method %s", m.Ident)
+		}
+
+		own := &InterfaceMethod{
+			Ident: m.Ident,
+			Func:  &FuncType{Variadic: fn.Variadic, ReturnType: fn.ReturnType},
+		}
+
+		for _, p := range fn.Params[1:] {
+			own.Func.Params = append(own.Func.Params, p.Type)
+		}
+
+		if !own.Func.Equals(m.Func) {
+			return nil, fmt.Errorf("method %s is %s, want %s", m.Ident, own.String(), m.String())
+		}
+
+		methods = append(methods, fn)
+	}
+
+	return methods, nil
+}
+
+// toInterface converts v, a pointer to a named type, to a value of the interface iface.
+// Other values are returned unchanged, for the caller to report the mismatch.
+func toInterface(scope ScopeLike, pos lexer.Position, v *Value, iface *Type) (*Value, error) {
+	if v.Type.IsInterface() || !v.Type.IsPointer() || v.Type.IsVoidPointer() {
+		return v, nil
+	}
+
+	typ := v.Type.Pointer()
+	if typ.IsInterface() {
+		return v, nil
+	}
+
+	methods, err := implements(scope, typ, iface)
+	if err != nil {
+		return nil, pkg.WithPos(fmt.Errorf("%s does not implement %s: %w", typ.String(), iface.String(), err), scope.Current().File, pos)
+	}
+
+	for _, fn := range methods {
+		if !fn.Params[0].Type.IsPointer() {
+			return nil, pkg.WithPos(fmt.Errorf("method %s of %s needs a pointer receiver to be called through %s", fn.Name, typ.String(), iface.String()), scope.Current().File, pos)
+		}
+	}
+
+	vtable, err := scope.CurrentModule().vtable(typ, iface, methods)
+	if err != nil {
+		return nil, err
+	}
+
+	data := castPointer(scope, v.Value, types.I8Ptr)
+	table := constant.NewGetElementPtr(vtable.ContentType, vtable, constant.NewInt(types.I64, 0), constant.NewInt(types.I64, 0))
+
+	if c, ok := data.(constant.Constant); ok {
+		return &Value{Type: iface, Value: constant.NewStruct(InterfaceIRType(), c, table)}, nil
+	}
+
+	bb := scope.BasicBlock()
+	agg := bb.NewInsertValue(constant.NewUndef(InterfaceIRType()), data, 0)
+
+	return &Value{Type: iface, Value: bb.NewInsertValue(agg, table, 1)}, nil
+}
+
+// vtable returns the vtable of typ for the interface iface, which is emitted once per program.
+func (m *Module) vtable(typ, iface *Type, methods []*Function) (*ir.Global, error) {
+	p := m.program()
+	name := fmt.Sprintf("vtable.%s.%s", typ.String(), iface.String())
+
+	if g, ok := p.vtables[name]; ok {
+		return g, nil
+	}
+
+	slots := make([]constant.Constant, 0, len(methods))
+
+	for _, fn := range methods {
+		if fn.Ptr == nil {
+			if err := fn.Declare(); err != nil {
+				return nil, err
+			}
+		}
+
+		slots = append(slots, constant.NewBitCast(fn.Ptr, types.I8Ptr))
+	}
+
+	init := constant.NewArray(types.NewArray(uint64(len(slots)), types.I8Ptr), slots...)
+
+	g := p.Ptr.NewGlobalDef(name, init)
+	g.Immutable = true
+	g.Linkage = enum.LinkagePrivate
+
+	if p.vtables == nil {
+		p.vtables = map[string]*ir.Global{}
+	}
+
+	p.vtables[name] = g
+
+	return g, nil
+}
+
+// interfaceCall calls the method of the interface value named by the accessor ao through its vtable.
+func (f *FnCallOp) interfaceCall(ao *AccessorOp, typ *Type) (*Value, error) {
+	index, method := typ.Interface().FindMethod(ao.Field)
+	if method == nil {
+		return nil, pkg.WithPos(fmt.Errorf("no method '%s' in %s", ao.Field, typ.String()), f.Scope.Current().File, ao.Pos)
+	}
+
+	recv, err := ao.Expr.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	bb := f.Scope.BasicBlock()
+
+	fat := recv.Value
+	if ao.Dereference {
+		fat = bb.NewLoad(InterfaceIRType(), recv.Value)
+	}
+
+	data := bb.NewExtractValue(fat, 0)
+	table := bb.NewExtractValue(fat, 1)
+	slot := bb.NewLoad(types.I8Ptr, bb.NewGetElementPtr(types.I8Ptr, table, constant.NewInt(types.I64, int64(index))))
+
+	self := NewTypeBasic(f.Scope, f.Pos, BasicTypeVoid).NewPointer()
+	ft := &FuncType{
+		Params:     append([]*Type{self}, method.Func.Params...),
+		ReturnType: method.Func.ReturnType,
+	}
+
+	sig, err := lowerSignature(ft.Params, false, ft.ReturnType)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{"'self'"}
+	for i := range method.Func.Params {
+		names = append(names, strconv.Itoa(i+1))
+	}
+
+	call := &FnCallOp{
+		Ident: ao.Field,
+		Args:  append([]ExpressionLike{&valueOp{Expr: ao.Expr, Val: &Value{Type: self, Value: data}}}, f.Args...),
+		Scope: f.Scope,
+		Pos:   f.Pos,
+	}
+
+	return call.call(ao.String(), ft, names, bb.NewBitCast(slot, types.NewPointer(sig.Sig)))
+}
+
+// checkBounds checks that the type arguments of an instantiation implement the bounds of their parameters.
+func checkBounds(scope ScopeLike, pos lexer.Position, kind, name string, params []string, bounds, args []*Type) error {
+	for i, b := range bounds {
+		if b == nil {
+			continue
+		}
+
+		if _, err := b.IRType(); err != nil {
+			return err
+		}
+
+		if !b.IsInterface() {
+			return pkg.WithPos(fmt.Errorf("bound %s of type parameter %s of %s %s is not an interface", b.String(), params[i], kind, name), scope.Current().File, pos)
+		}
+
+		if _, err := implements(scope, args[i], b); err != nil {
+			return pkg.WithPos(fmt.Errorf("type argument %s of %s %s does not implement %s: %w", args[i].String(), kind, name, b.String(), err), scope.Current().File, pos)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Astemirdum/si/pkg"
+)
+
+// Methods are functions declared against a type alias, e.g. i64 Node.len(Node* self). Their name is
+// mangled to Node.len, which no identifier can refer to, so they never clash with free functions.
+// The first parameter is the receiver, of the type or a pointer to it.
+
+// FindMethod returns the method name of the type alias receiver, from the module or its imports.
+func (m *Module) FindMethod(receiver, name string) *Function {
+	mangled := receiver + "." + name
+
+	for _, fn := range m.Functions {
+		if fn.Receiver == receiver && fn.Name == mangled {
+			return fn
+		}
+	}
+
+	for _, imp := range m.Imports {
+		for _, fn := range imp.Module.Functions {
+			if fn.Exported && fn.Receiver == receiver && fn.Name == mangled {
+				return fn
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkReceiver checks that the first parameter of a method is its receiver.
+func (f *Function) checkReceiver() error {
+	td := f.Scope.Parent.FindTypeDefByAlias(f.Receiver)
+	if td == nil {
+		return pkg.WithPos(fmt.Errorf("unknown receiver type '%s' of method %s", f.Receiver, f.Name), f.Scope.File, f.Pos)
+	}
+
+	// n.data() would be ambiguous with a field data of function type
+	ident := strings.TrimPrefix(f.Name, f.Receiver+".")
+
+	clash := false
+	switch {
+	case td.Type.IsStruct():
+		_, field, _ := td.Type.Struct().FindField(ident)
+		clash = field != nil
+	case td.Type.IsUnion():
+		_, field, _ := td.Type.Union().FindField(ident)
+		clash = field != nil
+	}
+
+	if clash {
+		return pkg.WithPos(fmt.Errorf("method %s has the same name as a field of %s", f.Name, f.Receiver), f.Scope.File, f.Pos)
+	}
+
+	if len(f.Params) > 0 {
+		t := f.Params[0].Type
+		if t._pointer != nil {
+			t = t._pointer
+		}
+
+		if t._alias == f.Receiver && len(t._typeArgs) == 0 {
+			return nil
+		}
+	}
+
+	return pkg.WithPos(fmt.Errorf("first parameter of method %s must be its receiver of type %s or %s*", f.Name, f.Receiver, f.Receiver), f.Scope.File, f.Pos)
+}
+
+// valueOp is an expression that is already evaluated, e.g. the receiver of a method call.
+type valueOp struct {
+	Expr ExpressionLike
+	Val  *Value
+}
+
+func (v *valueOp) String() string {
+	return v.Expr.String()
+}
+
+func (v *valueOp) Value() (*Value, error) {
+	return v.Val, nil
+}
+
+// methodCall calls the method named by the accessor ao with its receiver, e.g. head->len() or node.len().
+// The receiver is passed by address or by value, as the method expects. ok is false if ao is not a method,
+// e.g. a field of function type, which is called as a function value.
+func (f *FnCallOp) methodCall(ao *AccessorOp) (*Value, bool, error) {
+	typ, err := staticType(f.Scope, ao.Expr)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	if ao.Dereference {
+		if !typ.IsPointer() || typ.IsVoidPointer() {
+			return nil, false, nil
+		}
+
+		typ = typ.Pointer()
+	}
+
+	if typ.IsInterface() {
+		v, err := f.interfaceCall(ao, typ)
+
+		return v, true, err
+	}
+
+	if !typ.IsAlias() {
+		return nil, false, nil
+	}
+
+	if typ.IsStruct() {
+		if _, _, err := typ.Struct().FindField(ao.Field); err == nil {
+			return nil, false, nil
+		}
+	}
+
+	fn := f.Scope.CurrentModule().FindMethod(typ.Alias(), ao.Field)
+	if fn == nil {
+		return nil, true, pkg.WithPos(fmt.Errorf("no field or method '%s' in %s", ao.Field, typ.String()), f.Scope.Current().File, ao.Pos)
+	}
+
+	if fn.Ptr == nil {
+		if err := fn.Declare(); err != nil {
+			return nil, true, err
+		}
+	}
+
+	recv, err := ao.Expr.Value()
+	if err != nil {
+		return nil, true, err
+	}
+
+	bb := f.Scope.BasicBlock()
+	byPointer := fn.Params[0].Type.IsPointer()
+
+	switch {
+	case byPointer && !ao.Dereference:
+		// a receiver without an address, e.g. a struct returned from a function, is stored in a temporary,
+		// and so is a constant, which can't be written to through the pointer
+		ptr := recv.Ptr
+		if ptr == nil || recv.Const {
+			irType, err := recv.Type.IRType()
+			if err != nil {
+				return nil, true, err
+			}
+
+			ptr = bb.NewAlloca(irType)
+			bb.NewStore(recv.Value, ptr)
+		}
+
+		recv = &Value{Type: recv.Type.NewPointer(), Value: ptr}
+	case !byPointer && ao.Dereference:
+		irType, err := typ.IRType()
+		if err != nil {
+			return nil, true, err
+		}
+
+		recv = &Value{Type: typ, Ptr: recv.Value, Value: bb.NewLoad(irType, recv.Value)}
+	}
+
+	call := &FnCallOp{
+		Ident: fn.Name,
+		Args:  append([]ExpressionLike{&valueOp{Expr: ao.Expr, Val: recv}}, f.Args...),
+		Scope: f.Scope,
+		Pos:   f.Pos,
+	}
+
+	names := make([]string, 0, len(fn.Params))
+	for _, p := range fn.Params {
+		names = append(names, "'"+p.Ident+"'")
+	}
+
+	v, err := call.call(fn.Name, fn.Type().Func(), names, fn.Ptr)
+
+	return v, true, err
+}
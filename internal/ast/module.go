@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/Astemirdum/si/pkg"
 
@@ -11,10 +12,18 @@ import (
 func (m *Module) String() []string {
 	var lines []string
 
+	for _, imp := range m.Imports {
+		lines = append(lines, fmt.Sprintf("import %q;", imp.Path))
+	}
+
 	for _, td := range m.LocalTypes {
 		lines = append(lines, td.String()...)
 	}
 
+	for _, g := range m.Globals {
+		lines = append(lines, g.String()...)
+	}
+
 	for _, fn := range m.Functions {
 		lines = append(lines, fn.String()...)
 	}
@@ -62,11 +71,24 @@ func (m *Module) FindTypeDefByAlias(alias string) *TypeDef {
 		}
 	}
 
+	for _, imp := range m.Imports {
+		for _, td := range imp.Module.LocalTypes {
+			if td.Exported && td.Alias == alias {
+				return td
+			}
+		}
+	}
+
 	return nil
 }
 
 func (m *Module) FindTypeDefByType(typ *Type) *TypeDef {
 	for _, td := range m.LocalTypes {
+		// a generic type is only a template for its instances
+		if len(td.TypeParams) > 0 {
+			continue
+		}
+
 		if td.Type.Equals(typ) {
 			return td
 		}
@@ -82,6 +104,14 @@ func (m *Module) FindVariable(ident string) *Variable {
 		}
 	}
 
+	for _, imp := range m.Imports {
+		for _, g := range imp.Module.Globals {
+			if g.Exported && g.Variable.Ident == ident {
+				return g.Variable
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -92,6 +122,14 @@ func (m *Module) FindFunction(ident string) *Function {
 		}
 	}
 
+	for _, imp := range m.Imports {
+		for _, fn := range imp.Module.Functions {
+			if fn.Exported && fn.Name == ident {
+				return fn
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -111,29 +149,81 @@ func (m *Module) SetBasicBlock(b *ir.Block) {
 	m.CurrentBlock = b
 }
 
+// Generate generates the module and all modules it imports into a single IR module.
 func (m *Module) Generate() (*ir.Module, error) {
 	m.Ptr = ir.NewModule()
 
-	if len(m.Globals) > 0 {
-		panic("not implemented")
+	modules := m.modules()
+	for _, mod := range modules[:len(modules)-1] {
+		mod.Ptr = m.Ptr
+		mod.root = m
 	}
 
-	for _, fn := range m.Functions {
+	// globals come first, so that constants can be used in the signatures of functions
+	for _, mod := range modules {
+		for _, g := range mod.Globals {
+			if err := g.Generate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// declare all signatures before the bodies, so that the definition order doesn't matter.
+	// functions used to initialize globals, or called by their lambdas, are declared when they are used.
+	for _, mod := range modules {
+		for _, fn := range mod.Functions {
+			if fn.Ptr != nil || fn.IsGeneric() {
+				continue
+			}
+
+			if err := fn.Declare(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, mod := range modules {
+		for _, fn := range mod.Functions {
+			if fn.IsGeneric() {
+				continue
+			}
+
+			if err := fn.Generate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// the instances of generic functions, which can instantiate more of them
+	for len(m.pending) > 0 {
+		fn := m.pending[0]
+		m.pending = m.pending[1:]
+
 		if err := fn.Generate(); err != nil {
+			return nil, instantiationError(fn, err)
+		}
+	}
+
+	for _, mod := range modules {
+		if err := mod.generateTypeDefs(); err != nil {
 			return nil, err
 		}
 	}
 
+	return m.Ptr, nil
+}
+
+func (m *Module) generateTypeDefs() error {
 	for _, td := range m.ModuleTypeDefs {
 		for _, el := range m.Ptr.TypeDefs {
 			if el.Name() == td.Alias {
-				return nil, pkg.WithPos(fmt.Errorf("type alias %s already exists", td.Alias), m.Current().File, td.Type.Pos)
+				return pkg.WithPos(fmt.Errorf("type alias %s already exists", td.Alias), m.Current().File, td.Type.Pos)
 			}
 		}
 
 		irType, err := td.Type.IRType()
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// global module type definition must have a name set, because ir.Module LLString() will use it.
@@ -146,13 +236,76 @@ func (m *Module) Generate() (*ir.Module, error) {
 		m.Ptr.TypeDefs = append(m.Ptr.TypeDefs, irType)
 	}
 
-	return m.Ptr, nil
+	return nil
+}
+
+// modules returns m and the modules it imports, directly or not, each once and after all the modules it imports.
+// The loader rejects import cycles, so m is always the last one.
+func (m *Module) modules() []*Module {
+	var modules []*Module
+	seen := map[*Module]bool{}
+
+	var visit func(mod *Module)
+	visit = func(mod *Module) {
+		if seen[mod] {
+			return
+		}
+
+		seen[mod] = true
+
+		for _, imp := range mod.Imports {
+			visit(imp.Module)
+		}
+
+		modules = append(modules, mod)
+	}
+
+	visit(m)
+
+	return modules
+}
+
+// program returns the module being compiled, which m is a part of.
+func (m *Module) program() *Module {
+	if m.root != nil {
+		return m.root
+	}
+
+	return m
+}
+
+// Name is the name of the module's file without the .si extension.
+func (m *Module) Name() string {
+	return strings.TrimSuffix(m.Scope.File.Name, ".si")
+}
+
+// symbol returns the IR name of a function or global. The private ones of imported modules are
+// prefixed with the module name, so that files can use the same names for their own helpers.
+func (m *Module) symbol(name string, exported bool) string {
+	if m.root == nil || exported {
+		return name
+	}
+
+	return m.Name() + "." + name
 }
 
 func (m *Module) GenerateID(prefix string) string {
+	if m.root != nil {
+		return m.root.GenerateID(prefix)
+	}
+
 	id := fmt.Sprintf("%s.%d", prefix, m.LastID)
 
 	m.LastID++
 
 	return id
 }
+
+// exportPrefix is the keyword printed before exported definitions.
+func exportPrefix(exported bool) string {
+	if exported {
+		return "export "
+	}
+
+	return ""
+}
@@ -246,6 +246,34 @@ func (suite *TinyProgramsTestSuite) TestBinSearch() {
 	suite.EqualProgramSi(src, "4")
 }
 
+func (suite *TinyProgramsTestSuite) TestMutualRecursion() {
+	src := `
+i64 printf(i8 *fmt, ...);
+
+i64 main() {
+	printf("%d,%d,%d", isEven(10), isOdd(7), isEven(3));
+	return 0;
+}
+
+bool isEven(i64 n) {
+	if (n == 0) {
+		return true;
+	}
+
+	return isOdd(n - 1);
+}
+
+bool isOdd(i64 n) {
+	if (n == 0) {
+		return false;
+	}
+
+	return isEven(n - 1);
+}
+`
+	suite.EqualProgramSi(src, "1,1,0")
+}
+
 func TestTinyProgramsTestSuite(t *t.T) {
 	suite.Run(t, new(TinyProgramsTestSuite))
 }
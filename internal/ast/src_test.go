@@ -161,7 +161,7 @@ func (suite *SrcTestSuite) TestEmptyString() {
 }
 
 func (suite *SrcTestSuite) TestAlias0a() {
-	suite.ErrorGenerateExprSi(`hello a = (hello)10; bool d = a == 10;`, "incompatible types hello and i64", compiler.Declare("type i64 hello;"))
+	suite.ErrorGenerateExprSi(`hello a = (hello)10; i64 b = 10; bool d = a == b;`, "incompatible types hello and i64", compiler.Declare("type i64 hello;"))
 	suite.EqualExprSi(`hello a = (hello)10; bool d = a == (hello)10;`, `"%d", d`, "1", compiler.Declare("type i64 hello;"))
 	suite.EqualExprSi(`i64 f = 10; hello g = (hello)10; bool h = f == (i64)g;`, `"%d", h`, "1", compiler.Declare("type i64 hello;"), compiler.Basename("first"))
 }
@@ -557,3 +557,2247 @@ func (suite *SrcTestSuite) TestAvoidLeftRecursion() {
 	suite.EqualExprC(`int x = 3 -3;`, `"%d", x`, "0")
 	suite.EqualExprC(`int x = 3 - -3;`, `"%d", x`, "6")
 }
+
+func (suite *SrcTestSuite) TestGlobal() {
+	suite.T().Run("Counter", func(t *testing.T) {
+		src := `
+	i64 printf(i8 *fmt, ...);
+
+	i64 counter = 0;
+	const i64 step = 2;
+
+	void inc() {
+		counter = counter + step;
+		return;
+	}
+
+	i64 main() {
+		inc();
+		inc();
+		printf("%d", counter);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "4")
+	})
+
+	suite.T().Run("Zero Initialized", func(t *testing.T) {
+		src := `
+	type struct {
+		i64 a,
+		i64 b,
+	} pair;
+
+	i64 printf(i8 *fmt, ...);
+
+	[4]i64 table;
+	pair p;
+	i8* greeting = "hello";
+
+	i64 main() {
+		table[2] = 42;
+		p.b = 7;
+		printf("%d,%d,%d,%d,%s", table[0], table[2], p.a, p.b, greeting);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "0,42,0,7,hello")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorGenerateProgramSi(`
+	const i64 limit = 10;
+
+	i64 main() {
+		limit = 5;
+		return 0;
+	}
+	`, "cannot assign to constant")
+
+		suite.ErrorGenerateProgramSi(`
+	i64 x = 1;
+	i64 y = x;
+
+	i64 main() {
+		return 0;
+	}
+	`, "initializer of global 'y' is not a constant expression")
+
+		suite.ErrorGenerateProgramSi(`
+	const i64 z;
+
+	i64 main() {
+		return 0;
+	}
+	`, "constant 'z' must be initialized")
+	})
+}
+
+func (suite *SrcTestSuite) TestDuplicateFunction() {
+	suite.ErrorGenerateProgramSi(`
+	i64 f() {
+		return 1;
+	}
+
+	i64 f() {
+		return 2;
+	}
+
+	i64 main() {
+		return f();
+	}
+	`, "function 'f' already exists")
+}
+
+func (suite *SrcTestSuite) TestFnCallArgs() {
+	suite.T().Run("Variadic Promotion", func(t *testing.T) {
+		suite.EqualExprSi(`f32 f = (f32)1.5; i8 c = 'x'; u8 u = (u8)200; bool b = true;`, `"%.2f,%c,%d,%d", f, c, u, b`, "1.50,x,200,1")
+	})
+
+	suite.T().Run("Arity", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`i64 x = add(1);`, "not enough arguments in call to add: expected 2, got 1",
+			compiler.Declare("i64 add(i64 a, i64 b);"))
+		suite.ErrorGenerateExprSi(`i64 x = add(1, 2, 3);`, "too many arguments in call to add: expected 2, got 3",
+			compiler.Declare("i64 add(i64 a, i64 b);"))
+		suite.ErrorGenerateExprSi(`printf();`, "not enough arguments in call to printf: expected 1, got 0")
+	})
+
+	suite.T().Run("Types", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`i64 x = add(1, 2.5);`, "cannot use f64 as i64 in argument 'b' of add",
+			compiler.Declare("i64 add(i64 a, i64 b);"))
+	})
+}
+
+func (suite *SrcTestSuite) TestShortCircuit() {
+	suite.T().Run("Null Check", func(t *testing.T) {
+		src := `
+	type struct {
+		i64 data,
+		Node *next,
+	} Node;
+
+	i64 printf(i8 *fmt, ...);
+
+	bool positive(Node* p) {
+		return p != (Node*)NULL && p->data > 0;
+	}
+
+	bool emptyOrZero(Node* p) {
+		return p == (Node*)NULL || p->data == 0;
+	}
+
+	i64 main() {
+		Node n;
+		n.data = 5;
+		printf("%d,%d,%d,%d", positive((Node*)NULL), positive(&n), emptyOrZero((Node*)NULL), emptyOrZero(&n));
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "0,1,1,0")
+	})
+
+	suite.T().Run("Side Effects", func(t *testing.T) {
+		suite.EqualExprSi(`i64 x = 0; bool a = false && x++ > 0; bool b = true || x++ > 0; bool c = true && x++ > 0;`,
+			`"%d,%d,%d,%d", a, b, c, x`, "0,1,0,1")
+	})
+
+	suite.T().Run("Precedence", func(t *testing.T) {
+		suite.EqualExprSi(`bool a = true || false && false; bool b = false && true || true;`, `"%d,%d", a, b`, "1,1")
+		suite.EqualExprC(`int a = 1 || 0 && 0; int b = 0 && 1 || 1;`, `"%d,%d", a, b`, "1,1")
+	})
+
+	suite.T().Run("Non Bool", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`bool a = 1 && true;`, "operation && is not implemented for i64")
+	})
+}
+
+func (suite *SrcTestSuite) TestLoopTargets() {
+	suite.T().Run("Nested", func(t *testing.T) {
+		src := `
+	i64 printf(i8 *fmt, ...);
+
+	i64 main() {
+		i64 i;
+		i64 j;
+
+		for (i = 0; i < 4; i++;) {
+			if (i == 1) {
+				continue;
+			}
+
+			j = 0;
+			while (true) {
+				if (j == 2) {
+					break;
+				}
+				j++;
+				if (j == 1) {
+					continue;
+				}
+				printf("%d%d ", i, j);
+			}
+
+			if (i == 2) {
+				break;
+			}
+		}
+
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "02 22 ")
+	})
+
+	suite.T().Run("Labeled", func(t *testing.T) {
+		src := `
+	i64 printf(i8 *fmt, ...);
+
+	i64 main() {
+		i64 i = 0;
+		i64 j;
+
+		outer: while (i < 3) {
+			i++;
+			for (j = 0; j < 3; j++;) {
+				if (j == 1) {
+					continue outer;
+				}
+				if (i == 3) {
+					break outer;
+				}
+				printf("%d%d ", i, j);
+			}
+		}
+
+		printf("end %d", i);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "10 20 end 3")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`break;`, "invalid break statement: not inside a loop")
+		suite.ErrorGenerateExprSi(`while (true) { continue inner; }`, "invalid continue statement: unknown label 'inner'")
+		suite.ErrorGenerateExprSi(`a: while (true) { a: while (true) { break; } }`, "label 'a' already defined")
+	})
+}
+
+func (suite *SrcTestSuite) TestSwitch() {
+	suite.T().Run("Cases", func(t *testing.T) {
+		src := `
+	i64 printf(i8 *fmt, ...);
+
+	void classify(i64 x) {
+		switch (x) {
+		case 1:
+			printf("one ");
+			break;
+		case 2:
+		case 3:
+			printf("two-three ");
+			break;
+		case 4:
+			printf("four ");
+		case 5:
+			printf("five ");
+			break;
+		default:
+			printf("other ");
+		}
+		return;
+	}
+
+	i64 main() {
+		i64 i;
+		for (i = 0; i < 7; i++;) {
+			classify(i);
+		}
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "other one two-three two-three four five five other ")
+	})
+
+	suite.T().Run("Char And Continue", func(t *testing.T) {
+		src := `
+	i64 printf(i8 *fmt, ...);
+
+	i64 main() {
+		i8* s = "a1b2c";
+		i64 letters = 0;
+		i64 i;
+
+		for (i = 0; s[i] != (i8)0; i++;) {
+			switch (s[i]) {
+			case 'a':
+			case 'b':
+				letters++;
+				continue;
+			case '1':
+				break;
+			}
+			printf("%c", s[i]);
+		}
+
+		printf(" %d", letters);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "12c 2")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`i64 x = 1; switch (x) { case 1: break; case 1: break; }`, "duplicate case 1 in switch")
+		suite.ErrorGenerateExprSi(`i64 x = 1; i64 y = 2; switch (x) { case y: break; }`, "case label y is not a constant")
+		suite.ErrorGenerateExprSi(`i64 x = 1; switch (x) { case 'a': break; }`, "cannot use i8 as case label for switch on i64")
+		suite.ErrorGenerateExprSi(`f64 x = 1.0; switch (x) { default: break; }`, "cannot switch on f64")
+		suite.ErrorGenerateExprSi(`i64 x = 1; switch (x) { default: break; default: break; }`, "multiple defaults in switch")
+	})
+}
+
+func (suite *SrcTestSuite) TestDoWhile() {
+	src := `
+	i64 printf(i8 *fmt, ...);
+
+	i64 main() {
+		i64 x = 10;
+
+		do {
+			printf("%d ", x);
+			x++;
+		} while (x < 3);
+
+		x = 0;
+		do {
+			x++;
+			if (x == 2) {
+				continue;
+			}
+			if (x == 4) {
+				break;
+			}
+			printf("%d ", x);
+		} while (x < 10);
+
+		return 0;
+	}
+	`
+	suite.EqualProgramSi(src, "10 1 3 ")
+}
+
+func (suite *SrcTestSuite) TestConditional() {
+	suite.EqualExprSi(`i64 x = 5; i64 y = x > 3 ? 1 : 2; i64 z = x < 3 ? 1 : x == 5 ? 3 : 4;`, `"%d,%d", y, z`, "1,3")
+	suite.EqualExprC(`int x = 5; int y = x > 3 ? 1 : 2; int z = x < 3 ? 1 : x == 5 ? 3 : 4;`, `"%d,%d", y, z`, "1,3")
+
+	// only the selected arm is evaluated
+	suite.EqualExprSi(`i64 a = 0; i64 b = 0; i64 c = true ? a++ : b++;`, `"%d,%d,%d", a, b, c`, "1,0,0")
+	suite.EqualExprSi(`i8* p = "abc"; i8* q = p == (i8*)NULL ? "none" : p;`, `"%s", q`, "abc")
+
+	suite.ErrorGenerateExprSi(`i64 x = 1 ? 1 : 2;`, "cannot use i64 as condition")
+	suite.ErrorGenerateExprSi(`i64 x = true ? 1 : 2.0;`, "incompatible types i64 and f64")
+}
+
+func (suite *SrcTestSuite) TestCompoundAssign() {
+	suite.EqualExprSi(`i64 x = 10; x += 5; x -= 3; x *= 4; x /= 6; x %= 5;`, `"%d", x`, "3")
+	suite.EqualExprSi(`i64 m = 12; m |= 1; m &= 13; m ^= 4; m <<= 2; m >>= 1;`, `"%d", m`, "18")
+	suite.EqualExprC(`long m = 12; m |= 1; m &= 13; m ^= 4; m <<= 2; m >>= 1;`, `"%ld", m`, "18")
+	suite.EqualExprSi(`f64 f = 1.5; f *= 2.0; f += 0.25;`, `"%.2f", f`, "3.25")
+	suite.EqualExprSi(`i8* s = "hello"; s += 2;`, `"%s", s`, "llo")
+
+	// the left side is evaluated only once
+	suite.EqualExprSi(`[3]i64 a; a[0] = 1; a[1] = 2; a[2] = 3; i64 i = 0; a[i++] += 10;`, `"%d,%d,%d", a[0], a[1], i`, "11,2,1")
+
+	suite.ErrorGenerateExprSi(`i64 x = 1; x += 1.5;`, "incompatible types i64 and f64")
+
+	suite.T().Run("For", func(t *testing.T) {
+		src := `
+	i64 printf(i8 *fmt, ...);
+
+	i64 main() {
+		i64 x = 0;
+		i64 sum = 0;
+
+		for (x += 1; x < 10; x += 3;) {
+			sum += x;
+		}
+
+		for (x--; x > 0; x >>= 1;) {
+			printf("%d ", x);
+		}
+
+		printf("%d", sum);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "9 4 2 1 12")
+	})
+}
+
+func (suite *SrcTestSuite) TestStructLiteral() {
+	suite.T().Run("Usage", func(t *testing.T) {
+		src := `
+	type struct {
+		i64 x,
+		i64 y,
+	} Point;
+
+	type struct {
+		Point min,
+		Point max,
+		i8* name,
+	} Rect;
+
+	type struct {
+		i64 data,
+		Node *next,
+	} Node;
+
+	i64 printf(i8 *fmt, ...);
+
+	Point origin = Point{};
+	Point unit = Point{ .x = 1, .y = 1 };
+
+	Point add(Point a, Point b) {
+		return Point{ .x = a.x + b.x, .y = a.y + b.y };
+	}
+
+	i64 main() {
+		i64 n = 5;
+		Node last = Node{ .data = n, .next = NULL, };
+		Node first = Node{ .next = &last };
+		Rect r = Rect{
+			.name = "r",
+			.max = Point{ .x = n, .y = n * 2 },
+		};
+		Point p = add(unit, Point{ .y = 3 });
+		p = add(p, p);
+
+		printf("%d,%d|", first.data, first.next->data);
+		printf("%d,%d,%d,%d,%s|", r.min.x, r.min.y, r.max.x, r.max.y, r.name);
+		printf("%d,%d,%d|", p.x, p.y, origin.x + unit.y);
+		printf("%d", Point{ .x = 7 }.x);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "0,5|0,0,5,10,r|2,8,1|7")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		decl := compiler.Declare("type struct { i64 x, i64 y, } Point;")
+		suite.ErrorGenerateExprSi(`Point p = Point{ .z = 1 };`, "field 'z' not found in struct", decl)
+		suite.ErrorGenerateExprSi(`Point p = Point{ .x = 1, .x = 2 };`, "field 'x' initialized twice", decl)
+		suite.ErrorGenerateExprSi(`Point p = Point{ .x = 1.5 };`, "cannot use f64 as i64 in field 'x'", decl)
+		suite.ErrorGenerateExprSi(`Point p = Missing{ .x = 1 };`, "unknown type alias 'Missing'", decl)
+		suite.ErrorGenerateExprSi(`i64 p = Point{ .x = 1 };`, "cannot assign Point to i64", decl)
+	})
+}
+
+func (suite *SrcTestSuite) TestArrayLiteral() {
+	suite.T().Run("Usage", func(t *testing.T) {
+		src := `
+	type [4][4]f64 Mat;
+
+	i64 printf(i8 *fmt, ...);
+
+	[3]i64 primes = {2, 3, 5};
+	[2][3]i64 grid = {{1, 2, 3}, {4}};
+
+	f64 trace(Mat *m) {
+		f64 sum = 0.0;
+		i64 i;
+		for (i = 0; i < 4; i++;) {
+			sum += (*m)[i][i];
+		}
+		return sum;
+	}
+
+	i64 main() {
+		i64 n = 7;
+		[4]i64 a = {n, n * 2,};
+		Mat m = {
+			{1.0},
+			{0.0, 2.0},
+			{0.0, 0.0, 3.0},
+			{0.0, 0.0, 0.0, 4.5},
+		};
+		m[1][3] = 8.0;
+
+		printf("%d,%d,%d|", primes[0], primes[1], primes[2]);
+		printf("%d,%d,%d,%d|", grid[0][2], grid[1][0], grid[1][1], grid[1][2]);
+		printf("%d,%d,%d,%d|", a[0], a[1], a[2], a[3]);
+		printf("%.1f,%.1f", trace(&m), m[1][3]);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "2,3,5|3,4,0,0|7,14,0,0|10.5,8.0")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`[2]i64 a = {1, 2, 3};`, "too many elements in array literal for [2]i64: 3")
+		suite.ErrorGenerateExprSi(`[2]i64 a = {1, 2.5};`, "cannot use f64 as i64 in array element 1")
+		suite.ErrorGenerateExprSi(`i64 a = {1};`, "cannot use array literal as i64")
+		suite.ErrorGenerateExprSi(`[2][2]i64 a = {1, 2};`, "cannot use i64 as [2]i64 in array element 0")
+	})
+}
+
+func (suite *SrcTestSuite) TestFunctionPointer() {
+	suite.T().Run("Callbacks", func(t *testing.T) {
+		src := `
+	i64 printf(i8 *fmt, ...);
+	void qsort(i8* base, i64 n, i64 size, fn(i8*, i8*) -> i32 cmp);
+	i8* bsearch(i8* key, i8* base, i64 n, i64 size, fn(i8*, i8*) -> i32 cmp);
+
+	i32 cmp(i8* a, i8* b) {
+		i64* x = (i64*)a;
+		i64* y = (i64*)b;
+		if (*x < *y) {
+			return (i32)-1;
+		}
+		if (*x > *y) {
+			return (i32)1;
+		}
+		return (i32)0;
+	}
+
+	i64 main() {
+		[5]i64 v = {5, 3, 9, 1, 7};
+		qsort((i8*)&v, 5, sizeof(i64), cmp);
+
+		i64 key = 7;
+		i64* found = (i64*)bsearch((i8*)&key, (i8*)&v, 5, sizeof(i64), &cmp);
+
+		printf("%d%d%d%d%d|%d", v[0], v[1], v[2], v[3], v[4], *found);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "13579|7")
+	})
+
+	suite.T().Run("Dispatch", func(t *testing.T) {
+		src := `
+	type struct {
+		fn(Shape*) -> i64 area,
+		i64 w,
+		i64 h,
+	} Shape;
+
+	i64 printf(i8 *fmt, ...);
+
+	i64 rectArea(Shape* s) {
+		return s->w * s->h;
+	}
+
+	i64 triArea(Shape* s) {
+		return s->w * s->h / 2;
+	}
+
+	i64 add(i64 a, i64 b) { return a + b; }
+	i64 sub(i64 a, i64 b) { return a - b; }
+
+	fn(i64, i64) -> i64 defaultOp = add;
+
+	i64 main() {
+		Shape r = Shape{ .area = rectArea, .w = 3, .h = 4 };
+		Shape t = Shape{ .area = &triArea, .w = 3, .h = 4 };
+		[2]fn(i64, i64) -> i64 ops = {add, sub};
+		fn(i64, i64) -> i64 op = ops[1];
+
+		printf("%d,%d|", r.area(&r), (&t)->area(&t));
+		printf("%d,%d,%d|", ops[0](2, 3), op(2, 3), defaultOp(4, 4));
+		op = defaultOp;
+		printf("%d,%d", op(1, 1), op == add);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "12,6|5,-1,8|2,1")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		decl := compiler.Declare("i64 add(i64 a, i64 b) { return a + b; }")
+		suite.ErrorGenerateExprSi(`fn(i64) -> i64 f = add;`, "cannot assign fn(i64, i64) -> i64 to fn(i64) -> i64", decl)
+		suite.ErrorGenerateExprSi(`fn(i64, i64) -> i64 f = add; f(1);`, "not enough arguments in call to f: expected 2, got 1", decl)
+		suite.ErrorGenerateExprSi(`fn(i64, i64) -> i64 f = add; f(1, 2.5);`, "cannot use f64 as i64 in argument 2 of f", decl)
+		suite.ErrorGenerateExprSi(`i64 x = 1; x(1);`, "cannot call x of type i64", decl)
+	})
+}
+
+func (suite *SrcTestSuite) TestEnum() {
+	suite.T().Run("Usage", func(t *testing.T) {
+		src := `
+	type enum { RED, GREEN = 5, BLUE, } Color;
+	type enum { LOW = -1, HIGH } Level;
+
+	i64 printf(i8 *fmt, ...);
+
+	i8* name(Color c) {
+		switch (c) {
+		case Color.RED:
+			return "red";
+		case Color.GREEN:
+			return "green";
+		}
+
+		return "blue";
+	}
+
+	i64 main() {
+		Color c = Color.GREEN;
+		Color d = (Color)6;
+
+		printf("%s,%s,%s|", name(Color.RED), name(c), name(d));
+		printf("%d,%d,%d|", (i64)Color.BLUE, (i64)Level.LOW, (i32)Level.HIGH);
+		printf("%d,%d,%d", c == Color.GREEN, c != d, c < d);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "red,green,blue|6,-1,0|1,1,1")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		decl := compiler.Declare("type enum { RED, GREEN } Color; type enum { ON, OFF } Switch;")
+		suite.ErrorGenerateExprSi(`Color c = Color.BLUE;`, "member 'BLUE' not found in enum", decl)
+		suite.ErrorGenerateExprSi(`Color c = 1;`, "cannot assign i64 to Color", decl)
+		suite.ErrorGenerateExprSi(`Color c = Switch.ON;`, "cannot assign Switch to Color", decl)
+		suite.ErrorGenerateExprSi(`i64 x = Color.RED + 1;`, "incompatible types Color and i64", decl)
+		suite.ErrorGenerateExprSi(`bool b = Color.RED == Switch.ON;`, "incompatible types Color and Switch", decl)
+		suite.ErrorGenerateExprSi(`Color c = Color.RED + Color.GREEN;`, "operation + is not implemented for Color", decl)
+		suite.ErrorGenerateExprSi(`Color c = (Color)1.5;`, "casting from f64 to Color not implemented", decl)
+		suite.ErrorGenerateExprSi(`Color c = Color.RED;`, "duplicate enum member 'A'", compiler.Declare("type enum { A, A } Color;"))
+	})
+}
+
+func (suite *SrcTestSuite) TestUnion() {
+	suite.T().Run("Untagged", func(t *testing.T) {
+		src := `
+	type union {
+		u64 bits,
+		f64 real,
+		u32 low,
+	} Pun;
+
+	type struct {
+		i8 kind,
+		union { i32 small, i8* name, } data,
+	} Holder;
+
+	i64 printf(i8 *fmt, ...);
+
+	i64 main() {
+		Pun p = Pun{ .real = 0.1 };
+		Holder h;
+		h.data.name = "abc";
+
+		printf("%lx,%x|", p.bits, p.low);
+		p.bits = (u64)0;
+		printf("%.1f,%d,%d|", p.real, sizeof(Pun), sizeof(Holder));
+		printf("%s,%.1f", h.data.name, Pun{}.real);
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "3fb999999999999a,9999999a|0.0,8,16|abc,0.0")
+	})
+
+	suite.T().Run("Tagged", func(t *testing.T) {
+		src := `
+	type tagged union {
+		i64 Num,
+		Expr* Neg,
+		[2]Expr* Add,
+	} Expr;
+
+	i8* malloc(i64 size);
+	i64 printf(i8 *fmt, ...);
+
+	Expr* num(i64 n) {
+		Expr* e = (Expr*)malloc(sizeof(Expr));
+		*e = Expr{ .Num = n };
+		return e;
+	}
+
+	i64 eval(Expr* e) {
+		match (*e) {
+		case Num n:
+			return n;
+		case Neg x:
+			return -eval(x);
+		case Add args:
+			return eval(args[0]) + eval(args[1]);
+		}
+	}
+
+	i64 main() {
+		Expr* neg = (Expr*)malloc(sizeof(Expr));
+		*neg = Expr{ .Neg = num(2) };
+		Expr sum = Expr{ .Add = {num(40), neg} };
+
+		i64 kind = 0;
+		match (sum) {
+		case Num:
+			kind = 1;
+		default:
+			kind = 2;
+			break;
+			kind = 3;
+		}
+
+		printf("%d,%d,%d", eval(&sum), kind, sizeof(Expr));
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "38,2,24")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		decl := compiler.Declare("type union { i64 a, f64 b, } U; type tagged union { i64 Int, f64 Real, } V;")
+		suite.ErrorGenerateExprSi(`U u; u.c = 1;`, "field 'c' not found in union", decl)
+		suite.ErrorGenerateExprSi(`U u = U{ .a = 1, .b = 2.0 };`, "literal of U must set exactly one field", decl)
+		suite.ErrorGenerateExprSi(`V v = V{};`, "literal of V must set exactly one field", decl)
+		suite.ErrorGenerateExprSi(`V v = V{ .Int = 1 }; i64 x = v.Int;`, "cannot access variant 'Int' of V outside of match", decl)
+		suite.ErrorGenerateExprSi(`V v = V{ .Int = 1 }; match (v) { case Int: }`, "variant 'Real' of V not handled in match", decl)
+		suite.ErrorGenerateExprSi(`V v = V{ .Int = 1 }; match (v) { case Int: case Real: case Int: }`, "duplicate variant 'Int' in match", decl)
+		suite.ErrorGenerateExprSi(`V v = V{ .Int = 1 }; match (v) { case Str: default: }`, "variant 'Str' not found in tagged union", decl)
+		suite.ErrorGenerateExprSi(`U u; match (u) { default: }`, "cannot match on U", decl)
+		suite.ErrorGenerateExprSi(`V v = V{ .Real = true };`, "cannot use bool as f64 in field 'Real'", decl)
+	})
+}
+
+func (suite *SrcTestSuite) TestConst() {
+	suite.T().Run("Usage", func(t *testing.T) {
+		src := `
+	type enum { A, B, C } Kind;
+
+	const i64 N = 16 * 4;
+	const i64 HALF = N / 2 - (1 << 2);
+	const u8 MASK = (u8)-1 >> (u8)4;
+	const f64 SCALE = (f64)N * 0.5;
+	const bool BIG = N > 60 && !(HALF == 0);
+	const i64 WORDS = sizeof([N]i64) / sizeof(i64);
+
+	[HALF + 4]i64 table;
+
+	i64 printf(i8 *fmt, ...);
+
+	i64 classify(i64 x) {
+		switch (x) {
+		case N:
+			return 1;
+		case -N + 1:
+			return 2;
+		}
+
+		return 0;
+	}
+
+	i64 main() {
+		const i64 LOCAL = N + HALF;
+		[LOCAL / 16]i64 local = {1, 2, 3, 4, 5};
+		table[HALF + 3] = 7;
+
+		printf("%d,%d,%d,%.1f,%d,%d|", N, HALF, MASK, SCALE, BIG, WORDS);
+		printf("%d,%d,%d|", sizeof(table) / 8, sizeof(local) / 8, table[HALF + 3]);
+		printf("%d,%d,%d", classify(64), classify(-63), classify(LOCAL));
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "64,28,15,32.0,1,64|32,5,7|1,2,0")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`const i64 N = 1; N = 2;`, "cannot assign to constant N")
+		suite.ErrorGenerateExprSi(`const i64 N = 1; N++;`, "cannot increment/decrement a constant")
+		suite.ErrorGenerateExprSi(`const [3]i64 tab = {1, 2, 3}; tab[0] = 9;`, "cannot assign to constant tab[0]")
+		suite.ErrorGenerateExprSi(`const [3]i64 tab = {1, 2, 3}; tab[0] += 9;`, "cannot assign to constant tab[0]")
+		suite.ErrorGenerateExprSi(`const [3]i64 tab = {1, 2, 3}; tab[1]++;`, "cannot increment/decrement a constant")
+		suite.ErrorGenerateExprSi(`const P gp = P{ .x = 1 }; gp.x = 5;`, "cannot assign to constant gp.x", compiler.Declare("type struct { i64 x, } P;"))
+		suite.ErrorGenerateExprSi(`const P gp = P{ .x = 1 }; gp.x--;`, "cannot increment/decrement a constant", compiler.Declare("type struct { i64 x, } P;"))
+		suite.ErrorGenerateExprSi(`const i64 k = 1; i64* p = &k; *p = 9;`, "cannot take the address of constant k")
+		suite.ErrorGenerateExprSi(`const [3]i64 tab = {1, 2, 3}; i64* p = &tab[1];`, "cannot take the address of constant tab[1]")
+		suite.ErrorGenerateExprSi(`i64 x = T[2]; T[2] = x + 1;`, "cannot assign to constant T[2]", compiler.Declare("const [3]i64 T = {1, 2, 3};"))
+		suite.ErrorGenerateExprSi(`const i64 N;`, "constant 'N' must be initialized")
+		suite.ErrorGenerateExprSi(`i64 x = 1; const i64 N = x + 1;`, "initializer of constant 'N' is not a constant expression")
+		suite.ErrorGenerateExprSi(`const i64 N = 1 / 0;`, "division by zero in constant expression")
+		suite.ErrorGenerateExprSi(`i64 x = 1 << 64;`, "shift count 64 out of range for i64")
+		suite.ErrorGenerateExprSi(`i64 n = 3; [n]i64 a;`, "array length n is not an integer constant")
+		suite.ErrorGenerateExprSi(`const f64 F = 2.0; [F]i64 a;`, "array length F is not an integer constant")
+		suite.ErrorGenerateExprSi(`[2 - 2]i64 a;`, "array length must be greater than 0")
+	})
+}
+
+func (suite *SrcTestSuite) TestNumberLiteral() {
+	suite.T().Run("Formats", func(t *testing.T) {
+		suite.EqualExprSi(`i64 a = 0xFF; i64 b = 0o17; i64 c = 0b1010; i64 d = 1_000_000; i64 e = 010;`, `"%d,%d,%d,%d,%d", a, b, c, d, e`, "255,15,10,1000000,10")
+		suite.EqualExprSi(`f64 a = 1.5e-3; f64 b = 2E3; f64 c = .25;`, `"%g,%g,%g", a, b, c`, "0.0015,2000,0.25")
+		suite.EqualExprSi(`u64 a = 0xFFFF_FFFF_FFFF_FFFF; i64 b = -9223372036854775808;`, `"%llu,%lld", a, b`, "18446744073709551615,-9223372036854775808")
+	})
+
+	suite.T().Run("Suffix", func(t *testing.T) {
+		suite.EqualExprSi(`u8 a = 10u8; f32 b = 3.0f32; i64 c = (i64)0xFFu8 + 1; f64 d = (f64)1f32;`, `"%d,%g,%d,%g", a, (f64)b, c, d`, "10,3,256,1")
+		suite.ErrorGenerateExprSi(`i32 a = 10i64;`, "cannot assign i64 to i32")
+		suite.ErrorGenerateExprSi(`u8 a = 300u8;`, "constant 300u8 overflows u8")
+		suite.ErrorGenerateExprSi(`i32 a = 1.5i32;`, "invalid suffix i32 for floating point number 1.5i32")
+	})
+
+	suite.T().Run("Untyped", func(t *testing.T) {
+		src := `
+	i64 printf(i8 *fmt, ...);
+
+	type struct { u8 r, u8 g, u8 b, } Color;
+
+	i64 half(i32 x) {
+		return (i64)(x / 2);
+	}
+
+	i32 main() {
+		i8 a = -128;
+		u16 b = 65535;
+		f32 c = 2;
+		i32 d;
+		d = 7;
+		d += 1;
+		u32 e = d > 0 ? 1 : 2;
+		Color color = Color{ .r = 255, .g = 128, .b = 0 };
+		[3]u8 bytes = { 1, 2, 3 };
+		u64 f = 1 << 40;
+		bool g = (u8)200 > 100 && 1 < d;
+
+		switch (d) {
+		case 8:
+			printf("%d,%d,%g,%d,%d,%d,%d,%d,%lld,%d", a, b, (f64)c, half(d), e, color.r, bytes[2], g, f, d * 2 + 1);
+		}
+
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "-128,65535,2,4,1,255,3,1,1099511627776,17")
+	})
+
+	suite.T().Run("Folded", func(t *testing.T) {
+		suite.EqualExprSi(`i8 a = 100 + 27; u8 b = 300 - 100; const i8 C = -(127 + 1); u8 d = 255 * 2 / 2; f64 e = 1 + 0.5;`, `"%d,%d,%d,%d,%g", a, b, C, d, e`, "127,200,-128,255,1.5")
+	})
+
+	suite.T().Run("Overflow", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`i8 a = 128;`, "constant 128 overflows i8")
+		suite.ErrorGenerateExprSi(`i8 a = -129;`, "constant -129 overflows i8")
+		suite.ErrorGenerateExprSi(`u8 a = -1;`, "constant -1 overflows u8")
+		suite.ErrorGenerateExprSi(`u32 a; a = 0x1_0000_0000;`, "constant 0x1_0000_0000 overflows u32")
+		suite.ErrorGenerateExprSi(`i64 a = 9223372036854775808;`, "constant 9223372036854775808 overflows i64")
+		suite.ErrorGenerateExprSi(`f32 a = 1e39;`, "constant 1e39 overflows f32")
+		suite.ErrorGenerateExprSi(`i16 a = 1; i16 b = a + 40000;`, "constant 40000 overflows i16")
+		suite.ErrorGenerateExprSi(`i8 a = 127 + 1;`, "constant 127 + 1 overflows i8")
+		suite.ErrorGenerateExprSi(`u8 b = 200 + 100;`, "constant 200 + 100 overflows u8")
+		suite.ErrorGenerateExprSi(`const i8 C = 127 + 1;`, "constant 127 + 1 overflows i8")
+		suite.ErrorGenerateExprSi(`i8 a = 1; i8 b = a + (100 * 2);`, "constant 100 * 2 overflows i8")
+		suite.ErrorGenerateExprSi(`i64 a = 9223372036854775807 + 1;`, "constant 9223372036854775807 + 1 overflows i64")
+		suite.ErrorGenerateExprSi(`f32 a = 1e38 * 10;`, "constant 1e38 * 10 overflows f32")
+		suite.ErrorGenerateExprSi(`i64 a = (1 << 62) * 4;`, "constant (1 << 62) * 4 overflows i64")
+		suite.ErrorGenerateExprSi(`i8 a = 100 - (0 - 100);`, "constant 100 - (0 - 100) overflows i8")
+		suite.ErrorGenerateExprSi(`u8 a = -(2 - 1);`, "constant - (2 - 1) overflows u8")
+		suite.ErrorGenerateExprSi(`i32 a = 1.5;`, "cannot assign f64 to i32")
+	})
+}
+
+func (suite *SrcTestSuite) TestEscape() {
+	suite.T().Run("Char", func(t *testing.T) {
+		suite.EqualExprSi(`i8 a = '\n'; i8 b = '\0'; i8 c = '\''; i8 d = '\\'; i8 e = '\x41'; i8 f = '\101'; i8 g = '\v';`, `"%d,%d,%d,%d,%c,%c,%d", a, b, c, d, e, f, g`, "10,0,39,92,A,A,11")
+		suite.EqualExprSi(`u8 a = (u8)'\xFF'; i8 b = '\a'; i8 c = '\b'; i8 d = '\f'; i8 e = '"';`, `"%d,%d,%d,%d,%c", a, b, c, d, e`, "255,7,8,12,\"")
+	})
+
+	suite.T().Run("String", func(t *testing.T) {
+		suite.EqualExprSi(`i8* s = "\x48\151\u{21}\t\'\\\"";`, `"%s", s`, "Hi!\t'\\\"")
+		suite.EqualExprSi(`i8* s = "\u{e9}\u{1F600}";`, `"%s", s`, "é😀")
+		suite.EqualExprSi(`i8* s = "a\0b"; i64 n = strlen(s);`, `"%d", n`, "1", compiler.Declare("i64 strlen(i8* s);"))
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`i8* s = "ab\q";`, `invalid escape sequence \q`)
+		suite.ErrorGenerateExprSi(`i8 c = '\q';`, `invalid escape sequence \q`)
+		suite.ErrorGenerateExprSi(`i8* s = "\xZZ";`, `missing hex digits in escape sequence \x`)
+		suite.ErrorGenerateExprSi(`i8* s = "\400";`, `octal escape sequence \400 out of range`)
+		suite.ErrorGenerateExprSi(`i8* s = "\u{110000}";`, `invalid unicode escape sequence \u{110000}`)
+		suite.ErrorGenerateExprSi(`i8* s = "\u41";`, `invalid unicode escape sequence, expected \u{...}`)
+		suite.ErrorGenerateExprSi(`i8 c = '\u{e9}';`, `character literal '\u{e9}' must be a single byte`)
+		suite.ErrorGenerateExprSi(`i8 c = 'ab';`, `character literal 'ab' must be a single byte`)
+	})
+}
+
+func (suite *SrcTestSuite) TestImplicitConversion() {
+	suite.T().Run("BinaryOp", func(t *testing.T) {
+		suite.EqualExprSi(`i32 a = 40; i64 b = 2; i64 c = a + b; i8 d = -3; i16 e = (i16)d * (i16)100;`, `"%lld,%d", c, e`, "42,-300")
+		suite.EqualExprSi(`u8 a = 200; i64 b = -1; bool c = a > b; i8 d = -1; bool e = a > d; u32 f = 4000000000; i32 g = -1;`, `"%d,%d,%lld", c, e, f + g`, "1,1,3999999999")
+		suite.EqualExprSi(`i32 a = 3; f64 b = 0.5; f32 c = 1.5f32; i16 d = 2;`, `"%g,%g,%g", a * b, c + b, (f64)(c * d)`, "1.5,2,3")
+		suite.EqualExprSi(`u8 a = 1; i32 b = a << 3; i64 c = 1; c <<= a;`, `"%d,%lld", b, c`, "8,2")
+	})
+
+	suite.T().Run("Assignment", func(t *testing.T) {
+		src := `
+	i64 printf(i8 *fmt, ...);
+
+	type struct { i64 a, f64 b, } S;
+
+	i64 widen(i32 x) {
+		return x;
+	}
+
+	f64 half(f64 x) {
+		return x / 2.0;
+	}
+
+	i32 main() {
+		u8 small = 255;
+		i16 s = small;
+		i64 l;
+		l = s;
+		u64 big = small;
+		i32 n = 7;
+		f64 f = n;
+		f32 g = 1.5f32;
+		f64 h = g;
+		S st = S{ .a = n, .b = g };
+		[2]i64 arr = { n, small };
+
+		printf("%d,%lld,%llu,%g,%g,%lld,%g,%lld,%g,%lld,%lld", s, l, big, f, h, widen(n), half(n), st.a, st.b, arr[0], arr[1]);
+
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "255,255,255,7,1.5,7,3.5,7,1.5,7,255")
+	})
+
+	suite.T().Run("Cast", func(t *testing.T) {
+		suite.EqualExprSi(`u8 a = 200; i64 b = (i64)a; i64 c = 5000000000; f32 d = (f32)c; i32 e = (i32)c;`, `"%lld,%g,%d", b, (f64)d, e`, "200,5e+09,705032704")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`i64 a = 1; i32 b = a;`, "cannot assign i64 to i32")
+		suite.ErrorGenerateExprSi(`i8 a = 1; u8 b = a;`, "cannot assign i8 to u8")
+		suite.ErrorGenerateExprSi(`u32 a = 1; i32 b = a;`, "cannot assign u32 to i32")
+		suite.ErrorGenerateExprSi(`i64 a = 1; f64 b = a;`, "cannot assign i64 to f64")
+		suite.ErrorGenerateExprSi(`i32 a = 1; f32 b = a;`, "cannot assign i32 to f32")
+		suite.ErrorGenerateExprSi(`f64 a = 1.0; f32 b = a;`, "cannot assign f64 to f32")
+		suite.ErrorGenerateExprSi(`i32 a = 1; a += (i64)1;`, "cannot assign i64 to i32")
+		suite.ErrorGenerateExprSi(`u64 a = 1; i64 b = 1; bool c = a < b;`, "comparison of signed i64 and unsigned u64 needs an explicit cast")
+		suite.ErrorGenerateExprSi(`u64 a = 1; i64 b = 1; u64 c = a + b;`, "incompatible types u64 and i64")
+		suite.ErrorGenerateExprSi(`i64 a = 1; f64 b = 1.0; f64 c = a * b;`, "incompatible types i64 and f64")
+		suite.ErrorGenerateExprSi(`hello a = (hello)1; i64 b = a + (i32)1;`, "incompatible types hello and i32", compiler.Declare("type i64 hello;"))
+	})
+}
+
+func (suite *SrcTestSuite) TestVoidPointer() {
+	suite.T().Run("Usage", func(t *testing.T) {
+		src := `
+	i64 printf(i8 *fmt, ...);
+	void* malloc(i64 size);
+	void free(void* p);
+	void* memcpy(void* dst, void* src, i64 n);
+
+	type struct { i64 data, Node* next, } Node;
+
+	Node* find(Node* n, i64 data) {
+		while (n != NULL) {
+			if (n->data == data) {
+				return n;
+			}
+			n = n->next;
+		}
+		return NULL;
+	}
+
+	i64 count(Node* n) {
+		if (NULL == n) {
+			return 0;
+		}
+		return 1 + count(n->next);
+	}
+
+	i32 main() {
+		Node* a = malloc(sizeof(Node));
+		Node b = Node{ .data = 2, .next = NULL };
+		a->data = 1;
+		a->next = &b;
+
+		[4]i64 src = { 1, 2, 3, 4 };
+		i64* dst = malloc(sizeof([4]i64));
+		memcpy(dst, &src, sizeof([4]i64));
+
+		i64* first = &dst[0];
+		i64* last = &dst[3];
+		void* any = last;
+		i64* back = any;
+
+		printf("%d,%d,%d,%d,%lld,%lld,%d", count(a), find(a, 2) == &b, find(a, 3) == NULL, dst[2], last - first, first - last, *back);
+
+		free(dst);
+		free(a);
+
+		return 0;
+	}
+	`
+		suite.EqualProgramSi(src, "2,1,1,3,3,-3,4")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorGenerateExprSi(`i64 x = 1; void* p = &x; i64 y = *p;`, "cannot dereference void*")
+		suite.ErrorGenerateExprSi(`i64 x = 1; void* p = &x; void* q = p + 1;`, "cannot do arithmetic on void*")
+		suite.ErrorGenerateExprSi(`i64 x = 1; void* p = &x; p++;`, "cannot do arithmetic on void*")
+		suite.ErrorGenerateExprSi(`i64 x = 1; void* p = &x; i64 d = p - p;`, "cannot do arithmetic on void*")
+		suite.ErrorGenerateExprSi(`i64 x = 1; void* p = &x; i8 c = p[0];`, "cannot index void*")
+		suite.ErrorGenerateExprSi(`i64 x = 1; i32 y = 1; i64 d = &x - &y;`, "incompatible types i64* and i32*")
+		suite.ErrorGenerateExprSi(`i64 x = 1; i8* p = &x;`, "cannot assign i64* to i8*")
+		suite.ErrorGenerateExprSi(`i64 x = NULL;`, "cannot assign void* to i64")
+	})
+}
+
+func (suite *SrcTestSuite) TestCABI() {
+	lib := `
+	#include <stdio.h>
+
+	typedef struct { int x; char c; } Small;
+	typedef struct { long a; long b; } Pair;
+	typedef struct { double x; long n; } Mixed;
+	typedef struct { float x; float y; float z; } Vec3;
+	typedef struct { long a; long b; long c; } Big;
+
+	Small small_next(Small s) { Small r = { s.x + 1, s.c + 1 }; return r; }
+	Pair pair_swap(Pair p) { Pair r = { p.b, p.a }; return r; }
+	Mixed mixed_scale(Mixed m, double k) { Mixed r = { m.x * k, m.n * 2 }; return r; }
+	Vec3 vec_add(Vec3 a, Vec3 b) { Vec3 r = { a.x + b.x, a.y + b.y, a.z + b.z }; return r; }
+	Big big_sum(Big a, Big b) { Big r = { a.a + b.a, a.b + b.b, a.c + b.c }; return r; }
+	long pairs(Pair a, Pair b, Pair c, Pair d, long e) { return a.a + b.b + c.a + d.b + e; }
+	double mixeds(Mixed a, Mixed b, Mixed c, Mixed d, Mixed e, Mixed f, Mixed g, Mixed h, Mixed i) {
+		return a.x + b.x + c.x + d.x + e.x + f.x + g.x + h.x + i.x + i.n;
+	}
+	long flags(_Bool b, unsigned char u, signed char s, short h) { return b + u + s + h; }
+	Pair pair_apply(Pair (*f)(Pair), Pair p) { return f(f(p)); }
+	Big big_apply(Big (*f)(Big, long), Big b) { return f(b, 10); }
+	`
+
+	cMain := `
+	Pair twice(Pair p) { Pair r = { p.a * 2, p.b * 2 }; return r; }
+	Big shift(Big b, long k) { Big r = { b.a + k, b.b + k, b.c + k }; return r; }
+
+	int main() {
+		Small s = small_next((Small){ 41, 'a' });
+		Pair p = pair_swap((Pair){ 1, 2 });
+		Mixed m = mixed_scale((Mixed){ 1.5, 3 }, 2.0);
+		Vec3 v = vec_add((Vec3){ 1, 2, 3 }, (Vec3){ 0.5, 0.25, 0.125 });
+		Big b = big_sum((Big){ 1, 2, 3 }, (Big){ 10, 20, 30 });
+		Mixed x = { 0.5, 7 };
+		Pair q = pair_apply(twice, (Pair){ 3, 4 });
+		Big r = big_apply(shift, (Big){ 1, 2, 3 });
+
+		printf("%d,%c;", s.x, s.c);
+		printf("%ld,%ld;", p.a, p.b);
+		printf("%.2f,%ld;", m.x, m.n);
+		printf("%.3f,%.3f,%.3f;", (double)v.x, (double)v.y, (double)v.z);
+		printf("%ld,%ld,%ld;", b.a, b.b, b.c);
+		printf("%ld;", pairs(p, p, p, p, 100));
+		printf("%.2f;", mixeds(x, x, x, x, x, x, x, x, x));
+		printf("%ld;", flags(1, 200, -3, -1000));
+		printf("%ld,%ld;", q.a, q.b);
+		printf("%ld,%ld,%ld", r.a, r.b, r.c);
+		return 0;
+	}
+	`
+
+	src := `
+	type struct { i32 x, i8 c, } Small;
+	type struct { i64 a, i64 b, } Pair;
+	type struct { f64 x, i64 n, } Mixed;
+	type struct { f32 x, f32 y, f32 z, } Vec3;
+	type struct { i64 a, i64 b, i64 c, } Big;
+
+	i32 printf(i8* fmt, ...);
+
+	Small small_next(Small s);
+	Pair pair_swap(Pair p);
+	Mixed mixed_scale(Mixed m, f64 k);
+	Vec3 vec_add(Vec3 a, Vec3 b);
+	Big big_sum(Big a, Big b);
+	i64 pairs(Pair a, Pair b, Pair c, Pair d, i64 e);
+	f64 mixeds(Mixed a, Mixed b, Mixed c, Mixed d, Mixed e, Mixed f, Mixed g, Mixed h, Mixed i);
+	i64 flags(bool b, u8 u, i8 s, i16 h);
+	Pair pair_apply(fn(Pair) -> Pair f, Pair p);
+	Big big_apply(fn(Big, i64) -> Big f, Big b);
+
+	Pair twice(Pair p) {
+		return Pair{ .a = p.a * 2, .b = p.b * 2 };
+	}
+
+	Big shift(Big b, i64 k) {
+		return Big{ .a = b.a + k, .b = b.b + k, .c = b.c + k };
+	}
+
+	i32 main() {
+		Small s = small_next(Small{ .x = 41, .c = 'a' });
+		Pair p = pair_swap(Pair{ .a = 1, .b = 2 });
+		Mixed m = mixed_scale(Mixed{ .x = 1.5, .n = 3 }, 2.0);
+		Vec3 v = vec_add(Vec3{ .x = 1, .y = 2, .z = 3 }, Vec3{ .x = 0.5, .y = 0.25, .z = 0.125 });
+		Big b = big_sum(Big{ .a = 1, .b = 2, .c = 3 }, Big{ .a = 10, .b = 20, .c = 30 });
+		Mixed x = Mixed{ .x = 0.5, .n = 7 };
+		Pair q = pair_apply(twice, Pair{ .a = 3, .b = 4 });
+		Big r = big_apply(shift, Big{ .a = 1, .b = 2, .c = 3 });
+
+		printf("%d,%c;", s.x, s.c);
+		printf("%ld,%ld;", p.a, p.b);
+		printf("%.2f,%ld;", m.x, m.n);
+		printf("%.3f,%.3f,%.3f;", (f64)v.x, (f64)v.y, (f64)v.z);
+		printf("%ld,%ld,%ld;", b.a, b.b, b.c);
+		printf("%ld;", pairs(p, p, p, p, 100));
+		printf("%.2f;", mixeds(x, x, x, x, x, x, x, x, x));
+		printf("%ld;", flags(true, 200, -3, -1000));
+		printf("%ld,%ld;", q.a, q.b);
+		printf("%ld,%ld,%ld", r.a, r.b, r.c);
+		return 0;
+	}
+	`
+	suite.EqualProgramSiC(src, lib, cMain)
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorGenerateProgramSi(`
+	type struct { i64 a, } S;
+
+	S f() {
+		return 5;
+	}
+
+	i64 main() {
+		return f().a;
+	}
+	`, "cannot return i64 from function 'f' returning S")
+
+		suite.ErrorGenerateProgramSi(`
+	i64 f(i64 x) {
+		if (x > 0) {
+			return 1.5;
+		}
+
+		return 0;
+	}
+
+	i64 main() {
+		return f(1);
+	}
+	`, "cannot return f64 from function 'f' returning i64")
+
+		suite.ErrorGenerateProgramSi(`
+	type struct { i64 a, i64 b, i64 c, } Big;
+
+	Big f() {
+		return;
+	}
+
+	i64 main() {
+		return f().a;
+	}
+	`, "function 'f' must return a value of type Big")
+
+		suite.ErrorGenerateProgramSi(`
+	i64 f(i64 x) {
+		if (x > 0) {
+			return 1;
+		}
+	}
+
+	i64 main() {
+		return f(1);
+	}
+	`, "missing return at the end of function 'f'")
+	})
+}
+
+func (suite *SrcTestSuite) TestImplicitReturn() {
+	src := `
+	i64 printf(i8 *fmt, ...);
+
+	void hello() {
+		printf("hello,");
+	}
+
+	i64 sign(i64 x) {
+		if (x < 0) {
+			return -1;
+		} else {
+			return 1;
+		}
+	}
+
+	i64 name(i64 x) {
+		switch (x) {
+		case 1:
+			return 10;
+		default:
+			return 20;
+		}
+	}
+
+	i64 first(i64 from) {
+		while (true) {
+			if (from % 7 == 0) {
+				return from;
+			}
+			from += 1;
+		}
+	}
+
+	i64 main() {
+		hello();
+		closure() -> void bye = fn() -> void { printf("bye,"); };
+		bye();
+		printf("%d,%d,%d,%d", sign(-5), sign(5), name(1) + name(2), first(15));
+		return 0;
+	}
+	`
+	suite.EqualProgramSi(src, "hello,bye,-1,1,30,21")
+}
+
+func (suite *SrcTestSuite) TestImport() {
+	node := `
+	void* malloc(i64 size);
+
+	export type struct {
+		i64 data,
+		Node* next,
+	} Node;
+
+	export const i64 EMPTY = -1;
+
+	Node* alloc() {
+		return malloc(sizeof(Node));
+	}
+
+	export Node* push(Node* head, i64 data) {
+		Node* n = alloc();
+		n->data = data;
+		n->next = head;
+		return n;
+	}
+	`
+
+	list := `
+	import "node.si";
+
+	i64 printf(i8* fmt, ...);
+
+	i64 count = 0;
+
+	// a private helper, main.si has one with the same name
+	i64 helper(Node* n) {
+		count++;
+		if (n == NULL) {
+			return 0;
+		}
+		return n->data + helper(n->next);
+	}
+
+	export i64 sum(Node* head) {
+		return helper(head);
+	}
+
+	export void print(Node* head) {
+		while (head != NULL) {
+			printf("%d ", head->data);
+			head = head->next;
+		}
+		return;
+	}
+	`
+
+	stack := `
+	import "node.si";
+
+	export Node* pop(Node* head) {
+		return head->next;
+	}
+
+	export i64 top(Node* head) {
+		if (head == NULL) {
+			return EMPTY;
+		}
+		return head->data;
+	}
+	`
+
+	src := `
+	import "lib/list.si";
+	import "lib/stack.si";
+	import "lib/node.si";
+
+	i64 printf(i8* fmt, ...);
+
+	i64 helper() {
+		return 100;
+	}
+
+	i64 main() {
+		Node* l = NULL;
+		i64 i = 1;
+		while (i <= 4) {
+			l = push(l, i);
+			i++;
+		}
+
+		print(l);
+		printf("%d,%d,%d,%d,%d", sum(l), top(l), top(pop(l)), top(NULL), helper());
+
+		return 0;
+	}
+	`
+
+	files := []compiler.Option{
+		compiler.File("lib/node.si", node),
+		compiler.File("lib/list.si", list),
+		compiler.File("lib/stack.si", stack),
+	}
+
+	suite.T().Run("Program", func(t *testing.T) {
+		suite.EqualProgramSi(src, "4 3 2 1 10,4,3,-1,100", files...)
+	})
+
+	suite.T().Run("Private", func(t *testing.T) {
+		suite.ErrorGenerateProgramSi(`
+		import "lib/list.si";
+
+		i64 main() {
+			return helper(NULL);
+		}
+		`, "function helper not found", files...)
+
+		suite.ErrorGenerateProgramSi(`
+		import "lib/list.si";
+
+		i64 main() {
+			return count;
+		}
+		`, "variable count not found", files...)
+
+		// imports are not transitive
+		suite.ErrorGenerateProgramSi(`
+		import "lib/list.si";
+
+		i64 main() {
+			Node* n = NULL;
+			return 0;
+		}
+		`, "unknown type alias 'Node'", files...)
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorImportProgramSi(`
+		import "a.si";
+
+		i64 main() {
+			return 0;
+		}
+		`, "import cycle: a.si -> b.si -> a.si",
+			compiler.File("a.si", `import "b.si";`),
+			compiler.File("b.si", `import "a.si";`),
+		)
+
+		suite.ErrorImportProgramSi(`
+		import "missing.si";
+
+		i64 main() {
+			return 0;
+		}
+		`, "cannot import missing.si")
+
+		// diagnostics name the file the error is in
+		suite.ErrorGenerateProgramSi(`
+		import "bad.si";
+
+		i64 main() {
+			return 0;
+		}
+		`, "bad.si:3:11", compiler.File("bad.si", `
+		export i64 bad() {
+			return missing;
+		}
+		`))
+
+		// and print the source of that file
+		suite.ErrorGenerateProgramSi(`
+		import "sub/err.si";
+
+		i64 main() {
+			return 0;
+		}
+		`, "source:\n\n\t\t// sub/err.si\n", compiler.File("sub/err.si", `
+		// sub/err.si
+		export i64 bad() {
+			return missing;
+		}
+		`))
+
+		suite.ErrorGenerateProgramSi(`
+		import "lib/node.si";
+
+		Node* push(Node* head, i64 data) {
+			return head;
+		}
+
+		i64 main() {
+			return 0;
+		}
+		`, "function 'push' already exists", files...)
+	})
+}
+
+func (suite *SrcTestSuite) TestGeneric() {
+	suite.T().Run("Functions", func(t *testing.T) {
+		src := `
+		i64 printf(i8* fmt, ...);
+
+		T max<T>(T a, T b) {
+			if (a > b) {
+				return a;
+			}
+			return b;
+		}
+
+		void swap<T>(T* a, T* b) {
+			T tmp = *a;
+			*a = *b;
+			*b = tmp;
+			return;
+		}
+
+		A first<A, B>(A a, B b) {
+			return a;
+		}
+
+		i64 main() {
+			i32 x = 3;
+			i32 y = 7;
+			swap(&x, &y);
+
+			f64 f = max<f64>(1.5, 2);
+			u8 c = (u8)max(x, 5) + first<u8, bool>(1, true);
+
+			printf("%d,%d,%.1f,%d,%d,%d", x, y, f, max(-1, 1), c, sizeof(max(x, y)));
+			return 0;
+		}
+		`
+		suite.EqualProgramSi(src, "7,3,2.0,1,8,4")
+	})
+
+	suite.T().Run("Types", func(t *testing.T) {
+		src := `
+		i64 printf(i8* fmt, ...);
+		void* malloc(i64 size);
+
+		type struct<T> {
+			T data,
+			List<T>* next,
+		} List;
+
+		type struct<K, V> {
+			K key,
+			V value,
+		} Pair;
+
+		List<T>* push<T>(List<T>* head, T data) {
+			List<T>* n = malloc(sizeof(List<T>));
+			n->data = data;
+			n->next = head;
+			return n;
+		}
+
+		T sum<T>(List<T>* head) {
+			T total = 0;
+			while (head != NULL) {
+				total += head->data;
+				head = head->next;
+			}
+			return total;
+		}
+
+		List<T>* reverse<T>(List<T>* head) {
+			List<T>* prev = NULL;
+			while (head != NULL) {
+				List<T>* next = head->next;
+				head->next = prev;
+				prev = head;
+				head = next;
+			}
+			return prev;
+		}
+
+		i64 main() {
+			List<i64>* ints = NULL;
+			List<f64>* floats = NULL;
+
+			i64 i = 1;
+			while (i <= 4) {
+				ints = push(ints, i);
+				floats = push<f64>(floats, (f64)i * 0.5);
+				i++;
+			}
+
+			ints = reverse(ints);
+
+			Pair<i8, List<i64>*> p = Pair<i8, List<i64>*>{ .key = 'k', .value = ints };
+
+			printf("%d,%.1f,%d,%c,%d,%d", sum(ints), sum(floats), ints->data, p.key, p.value->next->data, sizeof(Pair<i8, f64>));
+			return 0;
+		}
+		`
+		suite.EqualProgramSi(src, "10,5.0,1,k,2,16")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		generic := `
+		type struct { i64 x, } Point;
+		type struct<T> { T data, } Box;
+
+		T add<T>(T a, T b) {
+			return a + b;
+		}
+		`
+
+		suite.ErrorGenerateProgramSi(generic+`
+		i64 main() {
+			Point p = Point{ .x = 1 };
+			Point q = add(p, p);
+			return 0;
+		}
+		`, "in instantiation add<Point>")
+
+		suite.ErrorGenerateProgramSi(generic+`
+		i64 main() {
+			i32 a = 1;
+			i64 b = add(a, 2i64);
+			return 0;
+		}
+		`, "type parameter T of add is both i32 and i64")
+
+		suite.ErrorGenerateProgramSi(generic+`
+		i64 main() {
+			i64 a = add<i64, i64>(1, 2);
+			return 0;
+		}
+		`, "function add expects 1 type arguments, got 2")
+
+		suite.ErrorGenerateProgramSi(generic+`
+		i64 main() {
+			Box b;
+			return 0;
+		}
+		`, "generic type Box needs type arguments")
+
+		suite.ErrorGenerateProgramSi(generic+`
+		i64 main() {
+			Point<i64> p;
+			return 0;
+		}
+		`, "type Point is not generic")
+
+		suite.ErrorGenerateProgramSi(generic+`
+		i64 main() {
+			fn(i64, i64) -> i64 f = add;
+			return 0;
+		}
+		`, "cannot use generic function add without calling it")
+	})
+}
+
+func (suite *SrcTestSuite) TestMethod() {
+	suite.T().Run("Methods", func(t *testing.T) {
+		src := `
+		i64 printf(i8* fmt, ...);
+
+		type struct {
+			i64 data,
+			Node* next,
+		} Node;
+
+		type struct {
+			f64 x,
+			f64 y,
+		} Vec;
+
+		i64 Node.len(Node* self) {
+			if (self == NULL) {
+				return 0;
+			}
+			return 1 + self->next->len();
+		}
+
+		void Node.inc(Node* self, i64 by) {
+			self->data += by;
+			return;
+		}
+
+		i64 Node.value(Node self) {
+			return self.data;
+		}
+
+		Vec Vec.add(Vec self, Vec o) {
+			return Vec{ .x = self.x + o.x, .y = self.y + o.y };
+		}
+
+		f64 Vec.dot(Vec* self, Vec o) {
+			return self->x * o.x + self->y * o.y;
+		}
+
+		// a free function with the same name as a method
+		i64 len(i64 x) {
+			return x;
+		}
+
+		i64 main() {
+			Node c = Node{ .data = 3, .next = NULL };
+			Node b = Node{ .data = 2, .next = &c };
+			Node a = Node{ .data = 1, .next = &b };
+			Node* head = &a;
+
+			head->inc(10);
+			b.inc(20);
+
+			Vec v = Vec{ .x = 1, .y = 2 };
+			Vec w = v.add(Vec{ .x = 3, .y = 4 });
+
+			printf("%d,%d,%d,%d,%d,%d,", head->len(), a.len(), len(7), head->value(), b.value(), a.next->value());
+			printf("%.1f,%.1f,%.1f", w.x, w.dot(v), v.add(v).dot(w));
+			return 0;
+		}
+		`
+		suite.EqualProgramSi(src, "3,3,7,11,22,22,4.0,16.0,32.0")
+	})
+
+	suite.T().Run("Import", func(t *testing.T) {
+		src := `
+		import "counter.si";
+
+		i64 main() {
+			Counter c = Counter{ .n = 40 };
+			c.add(2);
+			return c.get() - 42;
+		}
+		`
+		suite.EqualProgramSi(src, "", compiler.File("counter.si", `
+		export type struct { i64 n, } Counter;
+
+		export void Counter.add(Counter* self, i64 by) {
+			self->n += by;
+			return;
+		}
+
+		export i64 Counter.get(Counter* self) {
+			return self->n;
+		}
+		`))
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		types := `
+		type struct { i64 x, fn(i64) -> i64 f, } Point;
+		`
+
+		suite.ErrorGenerateProgramSi(types+`
+		i64 Point.get(i64 x) {
+			return x;
+		}
+		`, "first parameter of method Point.get must be its receiver of type Point or Point*")
+
+		suite.ErrorGenerateProgramSi(types+`
+		i64 Missing.get(Missing* m) {
+			return 0;
+		}
+		`, "unknown receiver type 'Missing' of method Missing.get")
+
+		suite.ErrorGenerateProgramSi(types+`
+		i64 main() {
+			Point p;
+			return p.get();
+		}
+		`, "no field or method 'get' in Point")
+
+		suite.ErrorGenerateProgramSi(types+`
+		i64 Point.get(Point* p) {
+			return p->x;
+		}
+
+		i64 main() {
+			Point p;
+			return get(&p);
+		}
+		`, "function get not found")
+
+		suite.ErrorGenerateProgramSi(types+`
+		i64 Point.get(Point* p) {
+			return p->x;
+		}
+
+		i64 main() {
+			Point p;
+			return p.get(1);
+		}
+		`, "too many arguments in call to Point.get: expected 0, got 1")
+
+		suite.ErrorGenerateProgramSi(types+`
+		i64 Point.add(Point* p, i64 n) {
+			return p->x + n;
+		}
+
+		i64 main() {
+			Point p;
+			return p.add();
+		}
+		`, "not enough arguments in call to Point.add: expected 1, got 0")
+
+		suite.ErrorGenerateProgramSi(types+`
+		i64 Point.x(Point* p) {
+			return 0;
+		}
+		`, "method Point.x has the same name as a field of Point")
+
+		suite.ErrorGenerateProgramSi(types+`
+		i64 main() {
+			Point p;
+			return p.x();
+		}
+		`, "cannot call p.x of type i64")
+	})
+}
+
+func (suite *SrcTestSuite) TestInterface() {
+	shapes := `
+		i64 printf(i8* fmt, ...);
+
+		type interface {
+			f64 area(),
+			void scale(f64 by),
+		} Shape;
+
+		type struct { f64 r, } Circle;
+		type struct { f64 w, f64 h, } Rect;
+
+		f64 Circle.area(Circle* self) {
+			return 3.0 * self->r * self->r;
+		}
+
+		void Circle.scale(Circle* self, f64 by) {
+			self->r = self->r * by;
+			return;
+		}
+
+		f64 Rect.area(Rect* self) {
+			return self->w * self->h;
+		}
+
+		void Rect.scale(Rect* self, f64 by) {
+			self->w = self->w * by;
+			self->h = self->h * by;
+			return;
+		}
+	`
+
+	suite.T().Run("Dynamic", func(t *testing.T) {
+		src := shapes + `
+		type struct { i64 id, Shape shape, } Entry;
+
+		f64 total(Shape* shapes, i64 n) {
+			f64 sum = 0.0;
+			i64 i = 0;
+			while (i < n) {
+				sum += shapes[i].area();
+				i += 1;
+			}
+			return sum;
+		}
+
+		f64 twice(Shape s) {
+			return 2.0 * s.area();
+		}
+
+		Shape pick(i64 i, Circle* c, Rect* r) {
+			if (i == 0) {
+				return c;
+			}
+			return r;
+		}
+
+		i64 main() {
+			Circle c = Circle{ .r = 1 };
+			Rect r = Rect{ .w = 2, .h = 3 };
+
+			Shape s = &r;
+			s.scale(2.0);
+
+			[3]Shape all = { &c, s, &c };
+			Entry e = Entry{ .id = 1, .shape = &c };
+			Shape* ps = &s;
+
+			printf("%.1f,%.1f,", total(&all[0], 3), r.w);
+			printf("%.1f,%.1f,%.1f,%.1f", twice(&c), e.shape.area(), ps->area(), pick(0, &c, &r).area());
+			return 0;
+		}
+		`
+		suite.EqualProgramSi(src, "30.0,4.0,6.0,3.0,24.0,3.0")
+	})
+
+	suite.T().Run("Bounds", func(t *testing.T) {
+		src := shapes + `
+		type interface<T> {
+			bool less(T* o),
+		} Ordered;
+
+		type struct { i64 key, } Item;
+
+		bool Item.less(Item* self, Item* o) {
+			return self->key < o->key;
+		}
+
+		void sort<T: Ordered<T>>(T* xs, i64 n) {
+			i64 i = 1;
+			while (i < n) {
+				i64 j = i;
+				while (j > 0 && xs[j].less(&xs[j - 1])) {
+					T tmp = xs[j];
+					xs[j] = xs[j - 1];
+					xs[j - 1] = tmp;
+					j -= 1;
+				}
+				i += 1;
+			}
+			return;
+		}
+
+		// statically dispatched for a type argument, dynamically for an interface
+		f64 largest<T: Shape>(T a, T b) {
+			if (a.area() > b.area()) {
+				return a.area();
+			}
+			return b.area();
+		}
+
+		i64 main() {
+			[4]Item items = { Item{ .key = 3 }, Item{ .key = 1 }, Item{ .key = 4 }, Item{ .key = 2 } };
+			sort(&items[0], 4);
+
+			Circle c = Circle{ .r = 2 };
+			Rect r = Rect{ .w = 2, .h = 3 };
+			Shape s = &r;
+
+			printf("%d%d%d%d,", items[0].key, items[1].key, items[2].key, items[3].key);
+			printf("%.1f,%.1f", largest(s, s), largest<Shape>(&c, &r));
+			return 0;
+		}
+		`
+		suite.EqualProgramSi(src, "1234,6.0,12.0")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		suite.ErrorGenerateProgramSi(shapes+`
+		type struct { f64 x, } Point;
+
+		f64 Point.area(Point* p) {
+			return p->x;
+		}
+
+		i64 main() {
+			Point p;
+			Shape s = &p;
+			return 0;
+		}
+		`, "Point does not implement Shape: missing method scale")
+
+		suite.ErrorGenerateProgramSi(shapes+`
+		type struct { f64 x, } Point;
+
+		i64 Point.area(Point* p) {
+			return 0;
+		}
+
+		void Point.scale(Point* p, f64 by) {
+			return;
+		}
+
+		i64 main() {
+			Point p;
+			Shape s = &p;
+			return 0;
+		}
+		`, "Point does not implement Shape: method area is i64 area(), want f64 area()")
+
+		suite.ErrorGenerateProgramSi(shapes+`
+		type struct { f64 x, } Point;
+
+		f64 Point.area(Point p) {
+			return p.x;
+		}
+
+		void Point.scale(Point* p, f64 by) {
+			return;
+		}
+
+		i64 main() {
+			Point p;
+			Shape s = &p;
+			return 0;
+		}
+		`, "method Point.area of Point needs a pointer receiver to be called through Shape")
+
+		suite.ErrorGenerateProgramSi(shapes+`
+		i64 main() {
+			Circle c;
+			Shape s = &c;
+			s.perimeter();
+			return 0;
+		}
+		`, "no method 'perimeter' in Shape")
+
+		suite.ErrorGenerateProgramSi(`
+		type interface { i64 len(), i64 len(), } Sized;
+
+		i64 main() {
+			Sized s;
+			return 0;
+		}
+		`, "duplicate interface method 'len'")
+
+		suite.ErrorGenerateProgramSi(shapes+`
+		f64 area<T: Shape>(T s) {
+			return s.area();
+		}
+
+		i64 main() {
+			area(1);
+			return 0;
+		}
+		`, "type argument i64 of function area does not implement Shape: only named types have methods")
+
+		suite.ErrorGenerateProgramSi(`
+		T id<T: i64>(T x) {
+			return x;
+		}
+
+		i64 main() {
+			return id(0);
+		}
+		`, "bound i64 of type parameter T of function id is not an interface")
+	})
+}
+
+func (suite *SrcTestSuite) TestClosure() {
+	suite.T().Run("Capture", func(t *testing.T) {
+		src := `
+		i64 printf(i8* fmt, ...);
+
+		type struct { closure(i64) -> i64 f, } Box;
+
+		closure(i64) -> i64 adder(i64 n) {
+			return fn(i64 x) -> i64 { return x + n; };
+		}
+
+		void each(i64* xs, i64 n, closure(i64) -> void f) {
+			i64 i = 0;
+			while (i < n) {
+				f(xs[i]);
+				i += 1;
+			}
+			return;
+		}
+
+		void map(i64* xs, i64 n, closure(i64) -> i64 f) {
+			i64 i = 0;
+			while (i < n) {
+				xs[i] = f(xs[i]);
+				i += 1;
+			}
+			return;
+		}
+
+		i64 filter(i64* xs, i64 n, closure(i64) -> bool keep, i64* out) {
+			i64 i = 0;
+			i64 kept = 0;
+			while (i < n) {
+				if (keep(xs[i])) {
+					out[kept] = xs[i];
+					kept += 1;
+				}
+				i += 1;
+			}
+			return kept;
+		}
+
+		i64 main() {
+			closure(i64) -> i64 add2 = adder(2);
+			Box b = Box{ .f = adder(10) };
+
+			[5]i64 xs = { 1, 2, 3, 4, 5 };
+			i64 factor = 3;
+			map(&xs[0], 5, fn(i64 x) -> i64 { return x * factor; });
+
+			i64 sum = 0;
+			each(&xs[0], 5, fn [&sum] (i64 x) -> void {
+				sum += x;
+				return;
+			});
+
+			[5]i64 odd;
+			i64 limit = 10;
+			i64 n = filter(&xs[0], 5, fn(i64 x) -> bool { return x % 2 == 1 && x < limit; }, &odd[0]);
+
+			// captured by value when the lambda is evaluated
+			i64 k = 1;
+			closure() -> i64 getK = fn() -> i64 { return k; };
+			k = 2;
+
+			i64 count = 0;
+			closure() -> void inc = fn [&count] () -> void {
+				count += 1;
+				return;
+			};
+			inc();
+			inc();
+
+			closure(i64) -> i64 twice = fn(i64 x) -> i64 {
+				closure(i64) -> i64 inner = fn(i64 y) -> i64 { return x + y; };
+				return inner(x);
+			};
+
+			closure(i64) -> i64 none = NULL;
+
+			printf("%d,%d,%d,%d,%d,%d,", add2(1), b.f(1), sum, n, odd[0], odd[1]);
+			printf("%d,%d,%d,%d", getK(), count, twice(21), none == NULL);
+			return 0;
+		}
+		`
+		suite.EqualProgramSi(src, "3,11,45,2,3,9,1,2,42,1")
+	})
+
+	suite.T().Run("Plain", func(t *testing.T) {
+		src := `
+		i64 printf(i8* fmt, ...);
+		void qsort(void* base, u64 n, u64 size, fn(void*, void*) -> i32 cmp);
+
+		i64 apply(fn(i64) -> i64 f, i64 x) {
+			return f(x);
+		}
+
+		i64 main() {
+			[4]i64 xs = { 3, 1, 4, 2 };
+			qsort(&xs[0], 4, 8, fn(void* a, void* b) -> i32 {
+				i64* x = a;
+				i64* y = b;
+				return (i32)(*x - *y);
+			});
+
+			printf("%d%d%d%d,%d", xs[0], xs[1], xs[2], xs[3], apply(fn(i64 x) -> i64 { return x * x; }, 7));
+			return 0;
+		}
+		`
+		suite.EqualProgramSi(src, "1234,49")
+	})
+
+	suite.T().Run("Global", func(t *testing.T) {
+		src := `
+		i64 printf(i8* fmt, ...);
+
+		fn() -> i64 g = fn() -> i64 { return helper() + 1; };
+		fn(i64) -> void show = fn(i64 x) -> void {
+			printf("%d,", x);
+			return;
+		};
+
+		i64 helper() {
+			return 41;
+		}
+
+		i64 main() {
+			show(g());
+			printf("%d", helper());
+			return 0;
+		}
+		`
+		suite.EqualProgramSi(src, "42,41")
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		apply := `
+		i64 apply(fn(i64) -> i64 f, i64 x) {
+			return f(x);
+		}
+		`
+
+		suite.ErrorGenerateProgramSi(apply+`
+		i64 main() {
+			i64 k = 1;
+			return apply(fn(i64 x) -> i64 { return x + k; }, 1);
+		}
+		`, "lambda capturing 'k' cannot be used as fn(i64) -> i64")
+
+		suite.ErrorGenerateProgramSi(apply+`
+		i64 main() {
+			i64 k = 1;
+			return apply(fn [k] (i64 x) -> i64 { return x; }, 1);
+		}
+		`, "lambda with captures cannot be used as fn(i64) -> i64")
+
+		suite.ErrorGenerateProgramSi(`
+		i64 g = 1;
+
+		i64 main() {
+			closure() -> i64 f = fn [&g] () -> i64 { return g; };
+			return f();
+		}
+		`, "cannot capture 'g', it is not a local variable")
+
+		suite.ErrorGenerateProgramSi(`
+		i64 main() {
+			closure(i64) -> i64 f = fn(i64 x) -> i64 { return x; };
+			return f();
+		}
+		`, "not enough arguments in call to f: expected 1, got 0")
+
+		suite.ErrorGenerateProgramSi(`
+		i64 main() {
+			i64 k = 1;
+			fn(i64) -> i64 f = fn(i64 x) -> i64 { return x + k; };
+			return f(1);
+		}
+		`, "lambda capturing 'k' cannot be used as fn(i64) -> i64")
+
+		suite.ErrorGenerateProgramSi(`
+		closure(i64) -> i64 id() {
+			return fn(i64 x) -> i64 { return x; };
+		}
+
+		i64 main() {
+			fn(i64) -> i64 f = id();
+			return f(1);
+		}
+		`, "cannot assign closure(i64) -> i64 to fn(i64) -> i64")
+	})
+}
+
+func (suite *SrcTestSuite) TestTuple() {
+	suite.T().Run("Values", func(t *testing.T) {
+		src := `
+		i64 printf(i8* fmt, ...);
+
+		type (i64, bool) Result;
+
+		(i64, i64) divmod(i64 a, i64 b) {
+			return a / b, a % b;
+		}
+
+		Result digit(i8 c) {
+			if (c < '0' || c > '9') {
+				return 0, false;
+			}
+			return (i64)(c - '0'), true;
+		}
+
+		(f64, (i64, i64)) nested() {
+			return 1.5, divmod(7, 2);
+		}
+
+		T first<T, U>((T, U) t) {
+			return t.0;
+		}
+
+		i64 main() {
+			i64 q, i64 r = divmod(17, 5);
+			(i64, i64) t = divmod(9, 4);
+			i64 n, bool ok = digit('7');
+			i64 m, bool bad = digit('x');
+			Result res = digit('3');
+			(f64, (i64, i64)) nest = nested();
+			(i64, bool) lit = (5, true);
+
+			t.0 = t.0 + 10;
+
+			printf("%d,%d,%d,%d,%d,%d,%d,%d,", q, r, t.0, t.1, n, ok, m, bad);
+			printf("%d,%.1f,%d,%d,%d,%d", res.0, nest.0, nest.1.0, nest.1.1, first(lit), divmod(20, 6).1);
+			return 0;
+		}
+		`
+		suite.EqualProgramSi(src, "3,2,12,1,7,1,0,0,3,1.5,3,1,5,2")
+	})
+
+	suite.T().Run("CABI", func(t *testing.T) {
+		lib := `
+		#include <stdio.h>
+		#include <stdbool.h>
+
+		typedef struct { long q; long r; } DivMod;
+		typedef struct { double value; bool ok; } Parsed;
+
+		DivMod divmod(long a, long b) {
+			DivMod d = { a / b, a % b };
+			return d;
+		}
+
+		Parsed half(long x) {
+			Parsed p = { x / 2.0, x % 2 == 0 };
+			return p;
+		}
+		`
+		src := `
+		i64 printf(i8* fmt, ...);
+		(i64, i64) divmod(i64 a, i64 b);
+		(f64, bool) half(i64 x);
+
+		i64 main() {
+			i64 q, i64 r = divmod(47, 10);
+			f64 h, bool even = half(7);
+			printf("%ld %ld %.1f %d\n", q, r, h, even);
+			return 0;
+		}
+		`
+		cMain := `
+		int main() {
+			DivMod d = divmod(47, 10);
+			Parsed p = half(7);
+			printf("%ld %ld %.1f %d\n", d.q, d.r, p.value, p.ok);
+			return 0;
+		}
+		`
+		suite.EqualProgramSiC(src, lib, cMain)
+	})
+
+	suite.T().Run("Errors", func(t *testing.T) {
+		divmod := `
+		(i64, i64) divmod(i64 a, i64 b) {
+			return a / b, a % b;
+		}
+		`
+
+		suite.ErrorGenerateProgramSi(divmod+`
+		i64 main() {
+			i64 a, i64 b, i64 c = divmod(1, 2);
+			return 0;
+		}
+		`, "cannot destructure (i64, i64) into 3 variables")
+
+		suite.ErrorGenerateProgramSi(divmod+`
+		i64 main() {
+			i64 a, bool b = divmod(1, 2);
+			return 0;
+		}
+		`, "cannot assign i64 to bool b")
+
+		suite.ErrorGenerateProgramSi(divmod+`
+		i64 main() {
+			(i64, i64) t = divmod(1, 2);
+			return t.2;
+		}
+		`, "tuple (i64, i64) has no element 2")
+
+		suite.ErrorGenerateProgramSi(`
+		(i64, bool) pair() {
+			return 1, 2.5;
+		}
+		`, "cannot use f64 as bool in tuple element 1")
+
+		suite.ErrorGenerateProgramSi(`
+		i64 main() {
+			i64 a, i64 b;
+			return 0;
+		}
+		`, "destructuring declaration needs a value")
+	})
+}
@@ -5,6 +5,10 @@ import (
 	"strings"
 
 	"github.com/Astemirdum/si/pkg"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
 )
 
 type StatementLikeList []StatementLike
@@ -32,14 +36,23 @@ func (a *ExprStmt) Generate() error {
 }
 
 func (d *DeclStmt) String() []string {
+	prefix := "decl "
+	if d.IsConst {
+		prefix = "decl const "
+	}
+
 	if d.Expr != nil {
-		return []string{"decl " + d.Type.String() + " " + d.Ident + " = " + d.Expr.String() + ";"}
+		return []string{prefix + d.Type.String() + " " + d.Ident + " = " + d.Expr.String() + ";"}
 	}
 
-	return []string{"decl " + d.Type.String() + " " + d.Ident + ";"}
+	return []string{prefix + d.Type.String() + " " + d.Ident + ";"}
 }
 
 func (d *DeclStmt) Generate() error {
+	if d.IsConst {
+		return d.generateConst()
+	}
+
 	typ, err := d.Type.IRType()
 	if err != nil {
 		return err
@@ -60,7 +73,7 @@ func (d *DeclStmt) Generate() error {
 	}
 
 	if d.Expr != nil {
-		expr, err := d.Expr.Value()
+		expr, err := valueAs(d.Scope, d.Pos, d.Expr, d.Type)
 		if err != nil {
 			return err
 		}
@@ -75,8 +88,54 @@ func (d *DeclStmt) Generate() error {
 	return nil
 }
 
+// generateConst stores a block-scoped constant as an immutable private global,
+// so that it behaves like a constant at module scope.
+func (d *DeclStmt) generateConst() error {
+	if d.Expr == nil {
+		return pkg.WithPos(fmt.Errorf("constant '%s' must be initialized", d.Ident), d.Scope.Current().File, d.Pos)
+	}
+
+	if _, err := d.Type.IRType(); err != nil {
+		return err
+	}
+
+	val, ok, err := evalConstant(d.Scope, d.Pos, d.Expr, d.Type)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return pkg.WithPos(fmt.Errorf("initializer of constant '%s' is not a constant expression", d.Ident), d.Scope.Current().File, d.Pos)
+	}
+
+	if !val.Type.Equals(d.Type) {
+		return pkg.WithPos(fmt.Errorf("cannot assign %s to %s", val.Type.String(), d.Type.String()), d.Scope.Current().File, d.Pos)
+	}
+
+	m := d.Scope.CurrentModule()
+
+	init := val.Value.(constant.Constant)
+	ptr := m.Ptr.NewGlobalDef(m.GenerateID("const."+d.Ident), init)
+	ptr.Immutable = true
+	ptr.Linkage = enum.LinkagePrivate
+
+	err = d.Scope.AddLocal(&Variable{
+		Ident:    d.Ident,
+		Type:     d.Type,
+		IsConst:  true,
+		Ptr:      ptr,
+		Constant: init,
+		Pos:      d.Pos,
+	})
+	if err != nil {
+		return pkg.WithPos(err, d.Scope.Current().File, d.Pos)
+	}
+
+	return nil
+}
+
 func (a *AssignStmt) String() []string {
-	return []string{"assign " + a.Left.String() + " = " + a.Right.String() + ";"}
+	return []string{"assign " + a.Left.String() + " " + a.Op + " " + a.Right.String() + ";"}
 }
 
 func (a *AssignStmt) Generate() error {
@@ -85,11 +144,27 @@ func (a *AssignStmt) Generate() error {
 		return err
 	}
 
-	right, err := a.Right.Value()
+	right, err := valueAs(a.Scope, a.Pos, a.Right, left.Type)
 	if err != nil {
 		return err
 	}
 
+	// compound assignment, the left side is evaluated only once and reused for the operation
+	if a.Op != "=" {
+		op := &BinaryOp{
+			Left:  a.Left,
+			Op:    strings.TrimSuffix(a.Op, "="),
+			Right: a.Right,
+			Scope: a.Scope,
+			Pos:   a.Pos,
+		}
+
+		right, err = op.apply(left, right)
+		if err != nil {
+			return err
+		}
+	}
+
 	if !left.Type.Equals(right.Type) {
 		return pkg.WithPos(fmt.Errorf("cannot assign %s to %s", right.Type.String(), left.Type.String()), a.Scope.Current().File, a.Pos)
 	}
@@ -98,79 +173,94 @@ func (a *AssignStmt) Generate() error {
 		return pkg.WithPos(fmt.Errorf("cannot assign to non-variable"), a.Scope.Current().File, a.Pos)
 	}
 
+	if left.Const {
+		return pkg.WithPos(fmt.Errorf("cannot assign to constant %s", sourceString(a.Left)), a.Scope.Current().File, a.Pos)
+	}
+
 	a.Scope.BasicBlock().NewStore(right.Value, left.Ptr)
 
 	return nil
 }
 
 func (r *ReturnStmt) String() []string {
+	if r.Expr == nil {
+		return []string{"return;"}
+	}
+
 	return []string{"return " + r.Expr.String() + ";"}
 }
 
 func (r *ReturnStmt) Generate() error {
+	fn := r.Scope.CurrentFunction()
+
 	if r.Expr == nil {
+		if !fn.ReturnType.IsVoid() {
+			return pkg.WithPos(fmt.Errorf("function '%s' must return a value of type %s", fn.Name, fn.ReturnType.String()), r.Scope.Current().File, r.Pos)
+		}
+
 		r.Scope.BasicBlock().NewRet(nil)
 		return nil
 	}
 
-	val, err := r.Expr.Value()
-
+	val, err := valueAs(r.Scope, r.Pos, r.Expr, fn.ReturnType)
 	if err != nil {
 		return err
 	}
 
-	r.Scope.BasicBlock().NewRet(val.Value)
+	if !val.Type.Equals(fn.ReturnType) {
+		return pkg.WithPos(fmt.Errorf("cannot return %s from function '%s' returning %s", val.Type.String(), fn.Name, fn.ReturnType.String()), r.Scope.Current().File, r.Pos)
+	}
+
+	fn.abi.emitReturn(fn, val.Value)
 
 	return nil
 }
 
 func (r *ContinueStmt) String() []string {
+	if r.Label != "" {
+		return []string{"continue " + r.Label + ";"}
+	}
+
 	return []string{"continue;"}
 }
 
 func (r *ContinueStmt) Generate() error {
-	const prevBlocks = 5
-	blocks := r.Scope.CurrentFunction().Ptr.Blocks
-	if len(blocks) < prevBlocks {
-		return fmt.Errorf("invalid break statement")
-	}
-	breakBlock := blocks[len(blocks)-prevBlocks]
-	if !isLoop(breakBlock.Ident()) {
-		return fmt.Errorf("invalid break statement in block")
+	target, err := r.Scope.CurrentFunction().FindLoop(r.Label, true)
+	if err != nil {
+		return pkg.WithPos(fmt.Errorf("invalid continue statement: %w", err), r.Scope.Current().File, r.Pos)
 	}
-	fmt.Println(blocks, breakBlock)
 
-	r.Scope.BasicBlock().NewBr(breakBlock)
+	r.Scope.BasicBlock().NewBr(target.Continue)
+	startUnreachable(r.Scope)
 
 	return nil
 }
 
-func isLoop(ident string) bool {
-	return strings.HasPrefix(ident, "%for.loop") || strings.HasPrefix(ident, "%while.loop")
-}
-
 func (r *BreakStmt) String() []string {
+	if r.Label != "" {
+		return []string{"break " + r.Label + ";"}
+	}
+
 	return []string{"break;"}
 }
 
 func (r *BreakStmt) Generate() error {
-	const prevBlocks = 4
-	blocks := r.Scope.CurrentFunction().Ptr.Blocks
-	if len(blocks) < prevBlocks {
-		return fmt.Errorf("invalid break statement")
-	}
-	breakBlock := blocks[len(blocks)-prevBlocks]
-	if !isMerge(breakBlock.Ident()) {
-		return fmt.Errorf("invalid break statement in block")
+	target, err := r.Scope.CurrentFunction().FindLoop(r.Label, false)
+	if err != nil {
+		return pkg.WithPos(fmt.Errorf("invalid break statement: %w", err), r.Scope.Current().File, r.Pos)
 	}
 
-	r.Scope.BasicBlock().NewBr(breakBlock)
+	r.Scope.BasicBlock().NewBr(target.Break)
+	startUnreachable(r.Scope)
 
 	return nil
 }
 
-func isMerge(ident string) bool {
-	return strings.HasPrefix(ident, "%for.merge") || strings.HasPrefix(ident, "%while.merge")
+// startUnreachable continues code generation in a new block after a jump,
+// so that statements following break/continue don't end up before the terminator.
+func startUnreachable(scope ScopeLike) {
+	block := scope.CurrentFunction().Ptr.NewBlock(scope.CurrentModule().GenerateID("unreachable"))
+	scope.SetBasicBlock(block)
 }
 
 func (i *IfStmt) String() []string {
@@ -255,6 +345,9 @@ func (i *IfStmt) Generate() error {
 
 func (w *WhileStmt) String() []string {
 	lines := []string{"while (" + w.Condition.String() + ")"}
+	if w.Label != "" {
+		lines[0] = w.Label + ": " + lines[0]
+	}
 
 	for _, stmt := range w.Body {
 		bodyLines := stmt.String()
@@ -291,6 +384,11 @@ func (w *WhileStmt) Generate() error {
 	w.Scope.BasicBlock().NewCondBr(expr.Value, loopBlock, mergeBlock)
 
 	// loop block
+	fn := w.Scope.CurrentFunction()
+	if err := fn.PushLoop(&LoopTarget{Label: w.Label, Break: mergeBlock, Continue: entryBlock}); err != nil {
+		return pkg.WithPos(err, w.Scope.Current().File, w.Pos)
+	}
+
 	w.Scope.SetBasicBlock(loopBlock)
 	for _, stmt := range w.Body {
 		if err := stmt.Generate(); err != nil {
@@ -298,6 +396,8 @@ func (w *WhileStmt) Generate() error {
 		}
 	}
 
+	fn.PopLoop()
+
 	if w.Scope.BasicBlock().Term == nil {
 		w.Scope.BasicBlock().NewBr(entryBlock)
 	}
@@ -308,8 +408,78 @@ func (w *WhileStmt) Generate() error {
 	return nil
 }
 
+func (d *DoWhileStmt) String() []string {
+	lines := []string{"do"}
+	if d.Label != "" {
+		lines[0] = d.Label + ": " + lines[0]
+	}
+
+	for _, stmt := range d.Body {
+		bodyLines := stmt.String()
+
+		// if the statement is a block, don't indent it
+		if _, ok := stmt.(*Block); !ok {
+			d.Scope.Current().PrefixLines(bodyLines)
+		}
+
+		lines = append(lines, bodyLines...)
+	}
+
+	lines = append(lines, "while ("+d.Condition.String()+");")
+
+	return lines
+}
+
+func (d *DoWhileStmt) Generate() error {
+	loopBlock := d.Scope.CurrentFunction().Ptr.NewBlock(d.Scope.CurrentModule().GenerateID("do.loop"))
+	condBlock := d.Scope.CurrentFunction().Ptr.NewBlock(d.Scope.CurrentModule().GenerateID("do.cond"))
+	mergeBlock := d.Scope.CurrentFunction().Ptr.NewBlock(d.Scope.CurrentModule().GenerateID("do.merge"))
+
+	d.Scope.BasicBlock().NewBr(loopBlock)
+
+	// loop block, the body runs at least once
+	fn := d.Scope.CurrentFunction()
+	if err := fn.PushLoop(&LoopTarget{Label: d.Label, Break: mergeBlock, Continue: condBlock}); err != nil {
+		return pkg.WithPos(err, d.Scope.Current().File, d.Pos)
+	}
+
+	d.Scope.SetBasicBlock(loopBlock)
+	for _, stmt := range d.Body {
+		if err := stmt.Generate(); err != nil {
+			return err
+		}
+	}
+
+	fn.PopLoop()
+
+	if d.Scope.BasicBlock().Term == nil {
+		d.Scope.BasicBlock().NewBr(condBlock)
+	}
+
+	// condition block
+	d.Scope.SetBasicBlock(condBlock)
+	expr, err := d.Condition.Value()
+	if err != nil {
+		return err
+	}
+
+	if !expr.Type.IsBool() {
+		return pkg.WithPos(fmt.Errorf("cannot use %s as condition", expr.Type.String()), d.Scope.Current().File, d.Pos)
+	}
+
+	d.Scope.BasicBlock().NewCondBr(expr.Value, loopBlock, mergeBlock)
+
+	// merge block
+	d.Scope.SetBasicBlock(mergeBlock)
+
+	return nil
+}
+
 func (f *ForStmt) String() []string {
 	lines := []string{"for ("}
+	if f.Label != "" {
+		lines[0] = f.Label + ": " + lines[0]
+	}
 
 	if f.Init != nil {
 		lines = append(lines, f.Init.String()...)
@@ -340,6 +510,7 @@ func (f *ForStmt) String() []string {
 func (f *ForStmt) Generate() error {
 	entryBlock := f.Scope.CurrentFunction().Ptr.NewBlock(f.Scope.CurrentModule().GenerateID("for.entry"))
 	loopBlock := f.Scope.CurrentFunction().Ptr.NewBlock(f.Scope.CurrentModule().GenerateID("for.loop"))
+	postBlock := f.Scope.CurrentFunction().Ptr.NewBlock(f.Scope.CurrentModule().GenerateID("for.post"))
 	mergeBlock := f.Scope.CurrentFunction().Ptr.NewBlock(f.Scope.CurrentModule().GenerateID("for.merge"))
 
 	// Generate init statement
@@ -364,7 +535,12 @@ func (f *ForStmt) Generate() error {
 
 	f.Scope.BasicBlock().NewCondBr(expr.Value, loopBlock, mergeBlock)
 
-	// Loop block
+	// Loop block, continue jumps to the post statement
+	fn := f.Scope.CurrentFunction()
+	if err := fn.PushLoop(&LoopTarget{Label: f.Label, Break: mergeBlock, Continue: postBlock}); err != nil {
+		return pkg.WithPos(err, f.Scope.Current().File, f.Pos)
+	}
+
 	f.Scope.SetBasicBlock(loopBlock)
 	for _, stmt := range f.Body {
 		if err := stmt.Generate(); err != nil {
@@ -372,19 +548,137 @@ func (f *ForStmt) Generate() error {
 		}
 	}
 
-	// Generate post statement
+	fn.PopLoop()
+
+	if f.Scope.BasicBlock().Term == nil {
+		f.Scope.BasicBlock().NewBr(postBlock)
+	}
+
+	// Post block
+	f.Scope.SetBasicBlock(postBlock)
 	if f.Post != nil {
 		if err := f.Post.Generate(); err != nil {
 			return err
 		}
 	}
 
-	if f.Scope.BasicBlock().Term == nil {
-		f.Scope.BasicBlock().NewBr(entryBlock)
-	}
+	f.Scope.BasicBlock().NewBr(entryBlock)
 
 	// Merge block
 	f.Scope.SetBasicBlock(mergeBlock)
 
 	return nil
 }
+
+func (s *SwitchStmt) String() []string {
+	lines := []string{"switch (" + s.Expr.String() + ")"}
+
+	for _, c := range s.Cases {
+		if c.IsDefault {
+			lines = append(lines, "default:")
+		} else {
+			lines = append(lines, "case "+c.Value.String()+":")
+		}
+
+		for _, stmt := range c.Body {
+			bodyLines := stmt.String()
+			s.Scope.Current().PrefixLines(bodyLines)
+			lines = append(lines, bodyLines...)
+		}
+	}
+
+	return lines
+}
+
+func (s *SwitchStmt) Generate() error {
+	expr, err := s.Expr.Value()
+	if err != nil {
+		return err
+	}
+
+	if !expr.Type.IsInt() && !expr.Type.IsUInt() && !expr.Type.IsEnum() {
+		return pkg.WithPos(fmt.Errorf("cannot switch on %s", expr.Type.String()), s.Scope.Current().File, s.Pos)
+	}
+
+	fn := s.Scope.CurrentFunction()
+	m := s.Scope.CurrentModule()
+
+	var defaultBlock *ir.Block
+
+	blocks := make([]*ir.Block, len(s.Cases))
+	cases := []*ir.Case{}
+
+	for i, c := range s.Cases {
+		if c.IsDefault {
+			if defaultBlock != nil {
+				return pkg.WithPos(fmt.Errorf("multiple defaults in switch"), s.Scope.Current().File, c.Pos)
+			}
+
+			blocks[i] = fn.Ptr.NewBlock(m.GenerateID("switch.default"))
+			defaultBlock = blocks[i]
+
+			continue
+		}
+
+		blocks[i] = fn.Ptr.NewBlock(m.GenerateID("switch.case"))
+
+		val, err := valueFor(c.Value, expr.Type)
+		if err != nil {
+			return err
+		}
+
+		label, ok := val.Value.(*constant.Int)
+		if !ok {
+			return pkg.WithPos(fmt.Errorf("case label %s is not a constant", sourceString(c.Value)), s.Scope.Current().File, c.Pos)
+		}
+
+		if !val.Type.Equals(expr.Type) {
+			return pkg.WithPos(fmt.Errorf("cannot use %s as case label for switch on %s", val.Type.String(), expr.Type.String()), s.Scope.Current().File, c.Pos)
+		}
+
+		for _, el := range cases {
+			if el.X.(*constant.Int).X.Cmp(label.X) == 0 {
+				return pkg.WithPos(fmt.Errorf("duplicate case %s in switch", c.Value.String()), s.Scope.Current().File, c.Pos)
+			}
+		}
+
+		cases = append(cases, ir.NewCase(label, blocks[i]))
+	}
+
+	mergeBlock := fn.Ptr.NewBlock(m.GenerateID("switch.merge"))
+	if defaultBlock == nil {
+		defaultBlock = mergeBlock
+	}
+
+	s.Scope.BasicBlock().NewSwitch(expr.Value, defaultBlock, cases...)
+
+	// break jumps out of the switch, continue goes to the enclosing loop
+	if err := fn.PushLoop(&LoopTarget{Break: mergeBlock}); err != nil {
+		return pkg.WithPos(err, s.Scope.Current().File, s.Pos)
+	}
+
+	for i, c := range s.Cases {
+		s.Scope.SetBasicBlock(blocks[i])
+
+		for _, stmt := range c.Body {
+			if err := stmt.Generate(); err != nil {
+				return err
+			}
+		}
+
+		// fallthrough to the next case, like in C
+		if s.Scope.BasicBlock().Term == nil {
+			if i+1 < len(blocks) {
+				s.Scope.BasicBlock().NewBr(blocks[i+1])
+			} else {
+				s.Scope.BasicBlock().NewBr(mergeBlock)
+			}
+		}
+	}
+
+	fn.PopLoop()
+
+	s.Scope.SetBasicBlock(mergeBlock)
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+
+	"github.com/Astemirdum/si/pkg"
+)
+
+// Tuples: a tuple type (i64, bool) is laid out like a struct with unnamed fields, its elements are
+// accessed by their index, e.g. t.0. A function returns several values as a tuple, e.g. return q, r;
+// which is returned like a struct in the C ABI, and a declaration can destructure it into variables.
+
+type TupleType struct {
+	Types []*Type
+}
+
+func NewTypeTuple(scope ScopeLike, pos lexer.Position, elems ...*Type) *Type {
+	return &Type{
+		_tuple: &TupleType{
+			Types: elems,
+		},
+		Scope: scope,
+		Pos:   pos,
+	}
+}
+
+func (tt *TupleType) String() string {
+	elems := make([]string, 0, len(tt.Types))
+	for _, t := range tt.Types {
+		elems = append(elems, t.String())
+	}
+
+	return "(" + strings.Join(elems, ", ") + ")"
+}
+
+func (tt *TupleType) Equals(o *TupleType) bool {
+	return typeListEquals(tt.Types, o.Types)
+}
+
+// FindElement returns the element of the tuple named by its index, e.g. 0 in t.0.
+func (tt *TupleType) FindElement(name string) (int, *Type, error) {
+	index, err := strconv.Atoi(name)
+	if err != nil || index < 0 || index >= len(tt.Types) {
+		return 0, nil, fmt.Errorf("tuple %s has no element %s", tt.String(), name)
+	}
+
+	return index, tt.Types[index], nil
+}
+
+// fieldTypes returns the types of the fields of a struct, or of the elements of a tuple, which are laid out alike.
+func (t *Type) fieldTypes() []*Type {
+	if t.IsTuple() {
+		return t.Tuple().Types
+	}
+
+	fields := make([]*Type, 0, len(t.Struct().Fields))
+	for _, f := range t.Struct().Fields {
+		fields = append(fields, f.Type)
+	}
+
+	return fields
+}
+
+func (t *Type) tupleIRType() (types.Type, error) {
+	elems := make([]types.Type, 0, len(t.Tuple().Types))
+
+	for _, e := range t.Tuple().Types {
+		if e.IsVoid() {
+			return nil, pkg.WithPos(fmt.Errorf("tuple element cannot be void"), t.Scope.Current().File, t.Pos)
+		}
+
+		irType, err := e.IRType()
+		if err != nil {
+			return nil, err
+		}
+
+		elems = append(elems, irType)
+	}
+
+	return types.NewStruct(elems...), nil
+}
+
+func (t *TupleLiteralOp) String() string {
+	return "(" + ExpressionLikeList(t.Elems).String() + ")"
+}
+
+func (t *TupleLiteralOp) Value() (*Value, error) {
+	return t.ValueFor(nil)
+}
+
+// ValueFor converts the elements to the element types of the expected tuple, if it has as many.
+func (t *TupleLiteralOp) ValueFor(expected *Type) (*Value, error) {
+	if expected != nil && (!expected.IsTuple() || len(expected.Tuple().Types) != len(t.Elems)) {
+		expected = nil
+	}
+
+	elems := make([]*Type, 0, len(t.Elems))
+	values := make([]value.Value, 0, len(t.Elems))
+	allConstant := true
+
+	for i, e := range t.Elems {
+		var elemType *Type
+		if expected != nil {
+			elemType = expected.Tuple().Types[i]
+		}
+
+		v, err := valueAs(t.Scope, t.Pos, e, elemType)
+		if err != nil {
+			return nil, err
+		}
+
+		if elemType != nil && !v.Type.Equals(elemType) {
+			return nil, pkg.WithPos(fmt.Errorf("cannot use %s as %s in tuple element %d", v.Type.String(), elemType.String(), i), t.Scope.Current().File, t.Pos)
+		}
+
+		if _, ok := v.Value.(constant.Constant); !ok {
+			allConstant = false
+		}
+
+		elems = append(elems, v.Type)
+		values = append(values, v.Value)
+	}
+
+	typ := expected
+	if typ == nil {
+		typ = NewTypeTuple(t.Scope, t.Pos, elems...)
+	}
+
+	irType, err := typ.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	if allConstant {
+		consts := make([]constant.Constant, 0, len(values))
+		for _, v := range values {
+			consts = append(consts, v.(constant.Constant))
+		}
+
+		return &Value{Type: typ, Value: constant.NewStruct(irType.(*types.StructType), consts...)}, nil
+	}
+
+	var agg value.Value = constant.NewUndef(irType)
+	for i, v := range values {
+		agg = t.Scope.BasicBlock().NewInsertValue(agg, v, uint64(i))
+	}
+
+	return &Value{Type: typ, Value: agg}, nil
+}
+
+func (d *DestructureStmt) String() []string {
+	if d.Expr == nil {
+		return []string{"decl " + VariableList(d.Vars).String() + ";"}
+	}
+
+	return []string{"decl " + VariableList(d.Vars).String() + " = " + d.Expr.String() + ";"}
+}
+
+// Generate declares the variables after the tuple is evaluated, so it can't refer to them.
+func (d *DestructureStmt) Generate() error {
+	if d.Expr == nil {
+		return pkg.WithPos(fmt.Errorf("destructuring declaration needs a value"), d.Scope.Current().File, d.Pos)
+	}
+
+	elems := make([]*Type, 0, len(d.Vars))
+	for _, v := range d.Vars {
+		elems = append(elems, v.Type)
+	}
+
+	expected := NewTypeTuple(d.Scope, d.Pos, elems...)
+	if _, err := expected.IRType(); err != nil {
+		return err
+	}
+
+	val, err := valueAs(d.Scope, d.Pos, d.Expr, expected)
+	if err != nil {
+		return err
+	}
+
+	if !val.Type.IsTuple() || len(val.Type.Tuple().Types) != len(d.Vars) {
+		return pkg.WithPos(fmt.Errorf("cannot destructure %s into %d variables", val.Type.String(), len(d.Vars)), d.Scope.Current().File, d.Pos)
+	}
+
+	for i, v := range d.Vars {
+		if elem := val.Type.Tuple().Types[i]; !elem.Equals(v.Type) {
+			return pkg.WithPos(fmt.Errorf("cannot assign %s to %s", elem.String(), v.String()), d.Scope.Current().File, d.Pos)
+		}
+	}
+
+	bb := d.Scope.BasicBlock()
+
+	for i, v := range d.Vars {
+		irType, err := v.Type.IRType()
+		if err != nil {
+			return err
+		}
+
+		ptr := bb.NewAlloca(irType)
+		bb.NewStore(bb.NewExtractValue(val.Value, uint64(i)), ptr)
+
+		local := &Variable{
+			Ident: v.Ident,
+			Type:  v.Type,
+			Ptr:   ptr,
+			Pos:   v.Pos,
+		}
+
+		if err := d.Scope.AddLocal(local); err != nil {
+			return pkg.WithPos(err, d.Scope.Current().File, d.Pos)
+		}
+	}
+
+	return nil
+}
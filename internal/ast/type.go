@@ -37,7 +37,14 @@ type Type struct {
 	_array   *ArrayType
 	_struct  *StructType
 	_pointer *Type
+	_func    *FuncType
+	_enum    *EnumType
+	_union   *UnionType
+	_iface   *InterfaceType
+	_tuple   *TupleType
 	_alias   string
+	// type arguments of an alias of a generic type
+	_typeArgs []*Type
 
 	_cached types.Type
 
@@ -48,11 +55,11 @@ type Type struct {
 // AliasedType returns the type at the end of the alias chain.
 func (t *Type) AliasedType() *Type {
 	if t.IsAlias() {
-		td := t.Scope.FindTypeDefByAlias(t.Alias())
+		td, err := t.typeDef()
 
 		// should be impossible, because all aliased types should be defined
-		if td == nil {
-			panic(fmt.Sprintf("unknown type alias '%s'", t.Alias()))
+		if err != nil {
+			panic(err.Error())
 		}
 
 		return td.Type.AliasedType()
@@ -77,12 +84,55 @@ func (t *Type) Pointer() *Type {
 	return t.AliasedType()._pointer
 }
 
+func (t *Type) Func() *FuncType {
+	return t.AliasedType()._func
+}
+
+func (t *Type) Enum() *EnumType {
+	return t.AliasedType()._enum
+}
+
+func (t *Type) Union() *UnionType {
+	return t.AliasedType()._union
+}
+
+func (t *Type) Tuple() *TupleType {
+	return t.AliasedType()._tuple
+}
+
+func (t *Type) Interface() *InterfaceType {
+	return t.AliasedType()._iface
+}
+
 func (t *Type) Alias() string {
 	return t._alias
 }
 
+func (t *Type) TypeArgs() []*Type {
+	return t._typeArgs
+}
+
+// typeDef returns the definition of an alias, the instance of a generic type for its type arguments.
+func (t *Type) typeDef() (*TypeDef, error) {
+	td := t.Scope.FindTypeDefByAlias(t.Alias())
+
+	if td == nil {
+		return nil, pkg.WithPos(fmt.Errorf("unknown type alias '%s'", t.Alias()), t.Scope.Current().File, t.Pos)
+	}
+
+	if len(td.TypeParams) == 0 && len(t._typeArgs) == 0 {
+		return td, nil
+	}
+
+	return td.instance(t)
+}
+
 func (t *Type) String() string {
 	// we need to check for alias first, because IsBasic() and etc. will return true for aliases
+	if t.IsAlias() && len(t._typeArgs) > 0 {
+		return fmt.Sprintf("%s<%s>", t.Alias(), typeList(t._typeArgs))
+	}
+
 	if t.IsAlias() {
 		return t.Alias()
 	}
@@ -96,6 +146,16 @@ func (t *Type) String() string {
 		return t.Struct().String()
 	} else if t.IsPointer() {
 		return t.Pointer().String() + "*"
+	} else if t.IsFunc() {
+		return t.Func().String()
+	} else if t.IsEnum() {
+		return t.Enum().String()
+	} else if t.IsUnion() {
+		return t.Union().String()
+	} else if t.IsInterface() {
+		return t.Interface().String()
+	} else if t.IsTuple() {
+		return t.Tuple().String()
 	} else {
 		// TODO: better error handling
 		panic("unknown type")
@@ -150,7 +210,7 @@ func NewLLFloat(bitSize uint64, value float64) *constant.Float {
 }
 
 func NewNullPtr() *constant.Null {
-	return constant.NewNull(types.NewPointer(types.I8Ptr))
+	return constant.NewNull(types.I8Ptr)
 }
 
 func (t *Type) IRType() (types.Type, error) {
@@ -163,10 +223,9 @@ func (t *Type) IRType() (types.Type, error) {
 	// we must start with the aliased type, because any other type can be an alias type as well
 	// TODO: do we need this at all?
 	if t.IsAlias() {
-		td := t.Scope.FindTypeDefByAlias(t.Alias())
-
-		if td == nil {
-			return nil, pkg.WithPos(fmt.Errorf("unknown type alias '%s'", t.Alias()), t.Scope.Current().File, t.Pos)
+		td, err := t.typeDef()
+		if err != nil {
+			return nil, err
 		}
 
 		typ, err := td.Type.IRType()
@@ -198,6 +257,10 @@ func (t *Type) IRType() (types.Type, error) {
 	} else if t.IsArray() {
 		at := t.Array()
 
+		if err := at.resolve(t.Scope, t.Pos); err != nil {
+			return nil, err
+		}
+
 		if at.Len <= 0 {
 			return nil, pkg.WithPos(fmt.Errorf("array length must be greater than 0"), t.Scope.Current().File, t.Pos)
 		}
@@ -246,16 +309,81 @@ func (t *Type) IRType() (types.Type, error) {
 		}
 	} else if t.IsPointer() {
 		typ := t.Pointer()
-		if typ.IsVoid() {
-			return nil, pkg.WithPos(fmt.Errorf("cannot have pointer to void"), t.Scope.Current().File, t.Pos)
-		}
 
 		irType, err := typ.IRType()
 		if err != nil {
 			return nil, err
 		}
 
-		final = types.NewPointer(irType)
+		// void* is a generic pointer, lowered like C to i8*
+		if types.Equal(irType, types.Void) {
+			final = types.I8Ptr
+		} else {
+			final = types.NewPointer(irType)
+		}
+	} else if t.IsUnion() {
+		typ, err := t.unionIRType()
+		if err != nil {
+			return nil, err
+		}
+
+		final = typ
+	} else if t.IsEnum() {
+		et := t.Enum()
+
+		for i, m := range et.Members {
+			for _, o := range et.Members[:i] {
+				if o.Ident == m.Ident {
+					return nil, pkg.WithPos(fmt.Errorf("duplicate enum member '%s'", m.Ident), t.Scope.Current().File, m.Pos)
+				}
+			}
+		}
+
+		final = EnumBackingType()
+	} else if t.IsTuple() {
+		typ, err := t.tupleIRType()
+		if err != nil {
+			return nil, err
+		}
+
+		final = typ
+	} else if t.IsInterface() {
+		if err := t.Interface().check(t.Scope); err != nil {
+			return nil, err
+		}
+
+		final = InterfaceIRType()
+	} else if t.IsFunc() {
+		ft := t.Func()
+
+		for _, p := range ft.Params {
+			if p.IsVoid() {
+				return nil, pkg.WithPos(fmt.Errorf("function parameter cannot be void"), t.Scope.Current().File, t.Pos)
+			}
+		}
+
+		if ft.Closure && ft.Variadic {
+			return nil, pkg.WithPos(fmt.Errorf("closure cannot be variadic"), t.Scope.Current().File, t.Pos)
+		}
+
+		params := ft.Params
+		if ft.Closure {
+			params = append([]*Type{NewTypeBasic(t.Scope, t.Pos, BasicTypeVoid).NewPointer()}, params...)
+		}
+
+		lowered, err := lowerSignature(params, ft.Variadic, ft.ReturnType)
+		if err != nil {
+			return nil, err
+		}
+
+		sig := lowered.Sig
+
+		// a function value is always a pointer to the function, a closure adds its environment
+		if ft.Closure {
+			final = types.NewStruct(types.NewPointer(sig), types.I8Ptr)
+		} else {
+			final = types.NewPointer(sig)
+		}
 	} else {
 		return nil, pkg.WithPos(fmt.Errorf("unknown type"), t.Scope.Current().File, t.Pos)
 	}
@@ -386,6 +514,36 @@ func (t *Type) IsPointer() bool {
 	return t.Pointer() != nil
 }
 
+// IsVoidPointer reports whether t is void*, which can point to any object but can't be dereferenced.
+func (t *Type) IsVoidPointer() bool {
+	return t.IsPointer() && t.Pointer().IsVoid()
+}
+
+func (t *Type) IsFunc() bool {
+	return t.Func() != nil
+}
+
+// IsClosure reports whether t is a closure, a function value with an environment.
+func (t *Type) IsClosure() bool {
+	return t.IsFunc() && t.Func().Closure
+}
+
+func (t *Type) IsEnum() bool {
+	return t.Enum() != nil
+}
+
+func (t *Type) IsUnion() bool {
+	return t.Union() != nil
+}
+
+func (t *Type) IsTuple() bool {
+	return t.Tuple() != nil
+}
+
+func (t *Type) IsInterface() bool {
+	return t.Interface() != nil
+}
+
 func (t *Type) IsAlias() bool {
 	return t.Alias() != ""
 }
@@ -448,7 +606,7 @@ func (t *Type) Equals(o *Type) bool {
 
 	// if both are aliases, then they must be the same alias
 	if t.IsAlias() && o.IsAlias() {
-		return t.Alias() == o.Alias()
+		return t.Alias() == o.Alias() && typeListEquals(t._typeArgs, o._typeArgs)
 	}
 
 	// here, both are not aliases
@@ -460,6 +618,16 @@ func (t *Type) Equals(o *Type) bool {
 		return t.Struct().Equals(o.Struct())
 	} else if t.IsPointer() && o.IsPointer() {
 		return t.Pointer().Equals(o.Pointer())
+	} else if t.IsFunc() && o.IsFunc() {
+		return t.Func().Equals(o.Func())
+	} else if t.IsEnum() && o.IsEnum() {
+		return t.Enum() == o.Enum()
+	} else if t.IsUnion() && o.IsUnion() {
+		return t.Union().Equals(o.Union())
+	} else if t.IsInterface() && o.IsInterface() {
+		return t.Interface().Equals(o.Interface())
+	} else if t.IsTuple() && o.IsTuple() {
+		return t.Tuple().Equals(o.Tuple())
 	} else {
 		return false
 	}
@@ -475,6 +643,16 @@ func (t *Type) AliasOf(o *Type) bool {
 		return t.Struct().Equals(o.Struct())
 	} else if t.IsPointer() && o.IsPointer() {
 		return t.Pointer().Equals(o.Pointer())
+	} else if t.IsFunc() && o.IsFunc() {
+		return t.Func().Equals(o.Func())
+	} else if t.IsEnum() && o.IsEnum() {
+		return t.Enum() == o.Enum()
+	} else if t.IsUnion() && o.IsUnion() {
+		return t.Union().Equals(o.Union())
+	} else if t.IsInterface() && o.IsInterface() {
+		return t.Interface().Equals(o.Interface())
+	} else if t.IsTuple() && o.IsTuple() {
+		return t.Tuple().Equals(o.Tuple())
 	} else {
 		return false
 	}
@@ -483,13 +661,25 @@ func (t *Type) AliasOf(o *Type) bool {
 type ArrayType struct {
 	Type *Type
 	Len  int
+
+	// LenExpr is the constant expression of the length, until it is evaluated into Len
+	LenExpr ExpressionLike
 }
 
 func (at *ArrayType) String() string {
-	return fmt.Sprintf("%s[%d]", at.Type.String(), at.Len)
+	if at.LenExpr != nil {
+		return fmt.Sprintf("[%s]%s", at.LenExpr.String(), at.Type.String())
+	}
+
+	return fmt.Sprintf("[%d]%s", at.Len, at.Type.String())
 }
 
 func (at *ArrayType) Equals(o *ArrayType) bool {
+	// unresolved lengths are reported by IRType, here they just don't match
+	if at.resolve(at.Type.Scope, at.Type.Pos) != nil || o.resolve(o.Type.Scope, o.Type.Pos) != nil {
+		return false
+	}
+
 	if at.Len != o.Len {
 		return false
 	}
@@ -498,7 +688,12 @@ func (at *ArrayType) Equals(o *ArrayType) bool {
 }
 
 func (td *TypeDef) String() []string {
-	return []string{fmt.Sprintf("type %s %s", td.Type.String(), td.Alias)}
+	alias := td.Alias
+	if len(td.TypeParams) > 0 {
+		alias += "<" + strings.Join(td.TypeParams, ", ") + ">"
+	}
+
+	return []string{fmt.Sprintf("%stype %s %s", exportPrefix(td.Exported), td.Type.String(), alias)}
 }
 
 func NewTypeBasic(scope ScopeLike, pos lexer.Position, typ BasicType) *Type {
@@ -509,11 +704,13 @@ func NewTypeBasic(scope ScopeLike, pos lexer.Position, typ BasicType) *Type {
 	}
 }
 
-func NewTypeAlias(scope ScopeLike, pos lexer.Position, alias string) *Type {
+// NewTypeAlias returns an alias type, with type arguments if it names a generic type.
+func NewTypeAlias(scope ScopeLike, pos lexer.Position, alias string, typeArgs ...*Type) *Type {
 	return &Type{
-		_alias: alias,
-		Scope:  scope,
-		Pos:    pos,
+		_alias:    alias,
+		_typeArgs: typeArgs,
+		Scope:     scope,
+		Pos:       pos,
 	}
 }
 
@@ -527,6 +724,47 @@ func NewTypeStruct(scope ScopeLike, pos lexer.Position, fields ...*StructField)
 	}
 }
 
+func NewTypeFunc(scope ScopeLike, pos lexer.Position, params []*Type, variadic bool, returnType *Type) *Type {
+	return &Type{
+		_func: &FuncType{
+			Params:     params,
+			Variadic:   variadic,
+			ReturnType: returnType,
+		},
+		Scope: scope,
+		Pos:   pos,
+	}
+}
+
+// NewTypeClosure returns the type of closures called with params, returning returnType.
+func NewTypeClosure(scope ScopeLike, pos lexer.Position, params []*Type, variadic bool, returnType *Type) *Type {
+	t := NewTypeFunc(scope, pos, params, variadic, returnType)
+	t._func.Closure = true
+
+	return t
+}
+
+func NewTypeEnum(scope ScopeLike, pos lexer.Position, members ...*EnumMember) *Type {
+	return &Type{
+		_enum: &EnumType{
+			Members: members,
+		},
+		Scope: scope,
+		Pos:   pos,
+	}
+}
+
+func NewTypeUnion(scope ScopeLike, pos lexer.Position, tagged bool, fields ...*StructField) *Type {
+	return &Type{
+		_union: &UnionType{
+			Fields: fields,
+			Tagged: tagged,
+		},
+		Scope: scope,
+		Pos:   pos,
+	}
+}
+
 func (t *Type) NewPointer() *Type {
 	return &Type{
 		_pointer: t,
@@ -535,6 +773,18 @@ func (t *Type) NewPointer() *Type {
 	}
 }
 
+// NewArrayExpr creates an array type whose length is a constant expression evaluated on first use.
+func (t *Type) NewArrayExpr(l ExpressionLike) *Type {
+	return &Type{
+		_array: &ArrayType{
+			Type:    t,
+			LenExpr: l,
+		},
+		Scope: t.Scope,
+		Pos:   t.Pos,
+	}
+}
+
 func (t *Type) NewArray(l int) *Type {
 	return &Type{
 		_array: &ArrayType{
@@ -591,3 +841,78 @@ func (st *StructType) Equals(o *StructType) bool {
 
 	return true
 }
+
+type FuncType struct {
+	Params     []*Type
+	Variadic   bool
+	ReturnType *Type
+	// Closure is called with an environment, hidden from its parameters
+	Closure bool
+}
+
+func (ft *FuncType) String() string {
+	params := make([]string, 0, len(ft.Params)+1)
+	for _, p := range ft.Params {
+		params = append(params, p.String())
+	}
+
+	if ft.Variadic {
+		params = append(params, "...")
+	}
+
+	keyword := "fn"
+	if ft.Closure {
+		keyword = "closure"
+	}
+
+	return fmt.Sprintf("%s(%s) -> %s", keyword, strings.Join(params, ", "), ft.ReturnType.String())
+}
+
+func (ft *FuncType) Equals(o *FuncType) bool {
+	if len(ft.Params) != len(o.Params) || ft.Variadic != o.Variadic || ft.Closure != o.Closure {
+		return false
+	}
+
+	for i, p := range ft.Params {
+		if !p.Equals(o.Params[i]) {
+			return false
+		}
+	}
+
+	return ft.ReturnType.Equals(o.ReturnType)
+}
+
+type EnumMember struct {
+	Ident string
+	Value int64
+
+	Pos lexer.Position
+}
+
+type EnumType struct {
+	Members []*EnumMember
+}
+
+// EnumBackingType is the integer type used to store enum values.
+func EnumBackingType() *types.IntType {
+	return NewLLTypeInt(64)
+}
+
+func (et *EnumType) FindMember(ident string) (*EnumMember, error) {
+	for _, m := range et.Members {
+		if m.Ident == ident {
+			return m, nil
+		}
+	}
+
+	return nil, fmt.Errorf("member '%s' not found in enum", ident)
+}
+
+func (et *EnumType) String() string {
+	members := make([]string, 0, len(et.Members))
+	for _, m := range et.Members {
+		members = append(members, fmt.Sprintf("%s = %d", m.Ident, m.Value))
+	}
+
+	return fmt.Sprintf("enum { %s, }", strings.Join(members, ", "))
+}
@@ -0,0 +1,466 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+
+	"github.com/Astemirdum/si/pkg"
+)
+
+// UnionType is a C-style union, or a sum type when Tagged is set.
+// A tagged union stores the index of the active field next to the payload.
+type UnionType struct {
+	Fields []*StructField
+	Tagged bool
+}
+
+func (ut *UnionType) String() string {
+	fields := make([]string, 0, len(ut.Fields))
+	for _, f := range ut.Fields {
+		fields = append(fields, f.String())
+	}
+
+	prefix := "union"
+	if ut.Tagged {
+		prefix = "tagged union"
+	}
+
+	return fmt.Sprintf("%s { %s, }", prefix, strings.Join(fields, ", "))
+}
+
+func (ut *UnionType) Equals(o *UnionType) bool {
+	if ut.Tagged != o.Tagged || len(ut.Fields) != len(o.Fields) {
+		return false
+	}
+
+	for i, f := range ut.Fields {
+		if f.Ident != o.Fields[i].Ident || !f.Type.Equals(o.Fields[i].Type) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (ut *UnionType) FindField(field string) (int, *StructField, error) {
+	for i, f := range ut.Fields {
+		if f.Ident == field {
+			return i, f, nil
+		}
+	}
+
+	if ut.Tagged {
+		return 0, nil, fmt.Errorf("variant '%s' not found in tagged union", field)
+	}
+
+	return 0, nil, fmt.Errorf("field '%s' not found in union", field)
+}
+
+// payloadLayout returns the size and alignment of the storage shared by all fields.
+func (ut *UnionType) payloadLayout() (int, int, error) {
+	size, align := 0, 1
+
+	for _, f := range ut.Fields {
+		s, a, err := f.Type.Layout()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		size = max(size, s)
+		align = max(align, a)
+	}
+
+	return alignTo(size, align), align, nil
+}
+
+// payloadIRType lowers the shared storage to an array of integers as wide as the alignment,
+// so that it has both the size and the alignment of the largest member.
+func (ut *UnionType) payloadIRType() (types.Type, error) {
+	size, align, err := ut.payloadLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	return types.NewArray(uint64(size/align), NewLLTypeInt(uint64(align*8))), nil
+}
+
+// UnionTagType is the integer type of the tag of a tagged union.
+func UnionTagType() *types.IntType {
+	return NewLLTypeInt(64)
+}
+
+func alignTo(n, align int) int {
+	return (n + align - 1) / align * align
+}
+
+// Layout returns the size and the alignment in bytes of t, following the C rules for a 64-bit target.
+func (t *Type) Layout() (int, int, error) {
+	switch {
+	case t.IsVoid():
+		return 0, 0, pkg.WithPos(fmt.Errorf("void has no size"), t.Scope.Current().File, t.Pos)
+	case t.IsBool():
+		return 1, 1, nil
+	case t.IsBasic():
+		return t.BasicSize() / 8, t.BasicSize() / 8, nil
+	case t.IsClosure(), t.IsInterface():
+		return 16, 8, nil
+	case t.IsPointer(), t.IsFunc():
+		return 8, 8, nil
+	case t.IsEnum():
+		size := int(EnumBackingType().BitSize / 8)
+
+		return size, size, nil
+	case t.IsArray():
+		if err := t.Array().resolve(t.Scope, t.Pos); err != nil {
+			return 0, 0, err
+		}
+
+		size, align, err := t.Array().Type.Layout()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return size * t.Array().Len, align, nil
+	case t.IsStruct(), t.IsTuple():
+		size, align := 0, 1
+
+		for _, f := range t.fieldTypes() {
+			s, a, err := f.Layout()
+			if err != nil {
+				return 0, 0, err
+			}
+
+			size = alignTo(size, a) + s
+			align = max(align, a)
+		}
+
+		return alignTo(size, align), align, nil
+	case t.IsUnion():
+		ut := t.Union()
+
+		size, align, err := ut.payloadLayout()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if !ut.Tagged {
+			return size, align, nil
+		}
+
+		tag := int(UnionTagType().BitSize / 8)
+		align = max(align, tag)
+
+		return alignTo(alignTo(tag, align)+size, align), align, nil
+	}
+
+	return 0, 0, pkg.WithPos(fmt.Errorf("unknown layout of type %s", t.String()), t.Scope.Current().File, t.Pos)
+}
+
+func (t *Type) unionIRType() (types.Type, error) {
+	ut := t.Union()
+
+	if len(ut.Fields) == 0 {
+		return nil, pkg.WithPos(fmt.Errorf("union must have at least one field"), t.Scope.Current().File, t.Pos)
+	}
+
+	for i, f := range ut.Fields {
+		for _, o := range ut.Fields[:i] {
+			if o.Ident == f.Ident {
+				return nil, pkg.WithPos(fmt.Errorf("duplicate field '%s' in union", f.Ident), t.Scope.Current().File, t.Pos)
+			}
+		}
+	}
+
+	payload, err := ut.payloadIRType()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ut.Tagged {
+		return payload, nil
+	}
+
+	return types.NewStruct(UnionTagType(), payload), nil
+}
+
+// spill returns the address of v, storing it in a temporary if it is not a variable.
+func spill(scope ScopeLike, v *Value) (value.Value, error) {
+	if v.Ptr != nil {
+		return v.Ptr, nil
+	}
+
+	irType, err := v.Type.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	ptr := scope.BasicBlock().NewAlloca(irType)
+	scope.BasicBlock().NewStore(v.Value, ptr)
+
+	return ptr, nil
+}
+
+// unionPayload returns the address of the storage of the union at ptr, typed as a pointer to typ.
+func unionPayload(scope ScopeLike, ut *UnionType, unionIRType types.Type, ptr value.Value, typ *Type) (value.Value, error) {
+	irType, err := typ.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	bb := scope.BasicBlock()
+
+	if ut.Tagged {
+		ptr = bb.NewGetElementPtr(unionIRType, ptr, NewLLInt(32, 0), NewLLInt(32, 1))
+	}
+
+	return bb.NewBitCast(ptr, types.NewPointer(irType)), nil
+}
+
+func (ao *AccessorOp) unionValue(expr *Value) (*Value, error) {
+	ut := expr.Type.Union()
+
+	if ut.Tagged {
+		return nil, pkg.WithPos(fmt.Errorf("cannot access variant '%s' of %s outside of match", ao.Field, expr.Type.String()), ao.Scope.Current().File, ao.Pos)
+	}
+
+	_, field, err := ut.FindField(ao.Field)
+	if err != nil {
+		return nil, pkg.WithPos(err, ao.Scope.Current().File, ao.Pos)
+	}
+
+	irType, err := expr.Type.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	ptr, err := spill(ao.Scope, expr)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := unionPayload(ao.Scope, ut, irType, ptr, field.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldIRType, err := field.Type.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Value{
+		Type:  field.Type,
+		Ptr:   addr,
+		Value: ao.Scope.BasicBlock().NewLoad(fieldIRType, addr),
+		Const: expr.Const,
+	}, nil
+}
+
+// unionValue builds a union from a literal, which sets at most one field.
+// A tagged union literal must set exactly one variant.
+func (s *StructLiteralOp) unionValue() (*Value, error) {
+	ut := s.Type.Union()
+
+	if len(s.Fields) > 1 || ut.Tagged && len(s.Fields) == 0 {
+		return nil, pkg.WithPos(fmt.Errorf("literal of %s must set exactly one field", s.Type.String()), s.Scope.Current().File, s.Pos)
+	}
+
+	irType, err := s.Type.IRType()
+	if err != nil {
+		return nil, err
+	}
+
+	bb := s.Scope.BasicBlock()
+
+	ptr := bb.NewAlloca(irType)
+	bb.NewStore(constant.NewZeroInitializer(irType), ptr)
+
+	for _, f := range s.Fields {
+		index, field, err := ut.FindField(f.Ident)
+		if err != nil {
+			return nil, pkg.WithPos(err, s.Scope.Current().File, f.Pos)
+		}
+
+		v, err := valueAs(s.Scope, f.Pos, f.Expr, field.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		if !v.Type.Equals(field.Type) {
+			return nil, pkg.WithPos(fmt.Errorf("cannot use %s as %s in field '%s'", v.Type.String(), field.Type.String(), field.Ident), s.Scope.Current().File, f.Pos)
+		}
+
+		if ut.Tagged {
+			tag := bb.NewGetElementPtr(irType, ptr, NewLLInt(32, 0), NewLLInt(32, 0))
+			bb.NewStore(constant.NewInt(UnionTagType(), int64(index)), tag)
+		}
+
+		addr, err := unionPayload(s.Scope, ut, irType, ptr, field.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		bb.NewStore(v.Value, addr)
+	}
+
+	return &Value{
+		Type:  s.Type,
+		Value: bb.NewLoad(irType, ptr),
+	}, nil
+}
+
+func (m *MatchStmt) String() []string {
+	lines := []string{"match (" + m.Expr.String() + ")"}
+
+	for _, a := range m.Arms {
+		switch {
+		case a.IsDefault:
+			lines = append(lines, "default:")
+		case a.Binding != "":
+			lines = append(lines, "case "+a.Variant+" "+a.Binding+":")
+		default:
+			lines = append(lines, "case "+a.Variant+":")
+		}
+
+		lines = append(lines, a.Body.String()...)
+	}
+
+	return lines
+}
+
+func (m *MatchStmt) Generate() error {
+	expr, err := m.Expr.Value()
+	if err != nil {
+		return err
+	}
+
+	if !expr.Type.IsUnion() || !expr.Type.Union().Tagged {
+		return pkg.WithPos(fmt.Errorf("cannot match on %s", expr.Type.String()), m.Scope.Current().File, m.Pos)
+	}
+
+	ut := expr.Type.Union()
+
+	irType, err := expr.Type.IRType()
+	if err != nil {
+		return err
+	}
+
+	fn := m.Scope.CurrentFunction()
+	mod := m.Scope.CurrentModule()
+
+	var defaultBlock *ir.Block
+
+	handled := make([]bool, len(ut.Fields))
+	blocks := make([]*ir.Block, len(m.Arms))
+	cases := []*ir.Case{}
+
+	for i, a := range m.Arms {
+		if a.IsDefault {
+			if defaultBlock != nil {
+				return pkg.WithPos(fmt.Errorf("multiple defaults in match"), m.Scope.Current().File, a.Pos)
+			}
+
+			blocks[i] = fn.Ptr.NewBlock(mod.GenerateID("match.default"))
+			defaultBlock = blocks[i]
+
+			continue
+		}
+
+		index, _, err := ut.FindField(a.Variant)
+		if err != nil {
+			return pkg.WithPos(err, m.Scope.Current().File, a.Pos)
+		}
+
+		if handled[index] {
+			return pkg.WithPos(fmt.Errorf("duplicate variant '%s' in match", a.Variant), m.Scope.Current().File, a.Pos)
+		}
+
+		handled[index] = true
+
+		blocks[i] = fn.Ptr.NewBlock(mod.GenerateID("match.case"))
+		cases = append(cases, ir.NewCase(constant.NewInt(UnionTagType(), int64(index)), blocks[i]))
+	}
+
+	if defaultBlock == nil {
+		for i, f := range ut.Fields {
+			if !handled[i] {
+				return pkg.WithPos(fmt.Errorf("variant '%s' of %s not handled in match", f.Ident, expr.Type.String()), m.Scope.Current().File, m.Pos)
+			}
+		}
+	}
+
+	ptr, err := spill(m.Scope, expr)
+	if err != nil {
+		return err
+	}
+
+	bb := m.Scope.BasicBlock()
+	tag := bb.NewLoad(UnionTagType(), bb.NewGetElementPtr(irType, ptr, NewLLInt(32, 0), NewLLInt(32, 0)))
+
+	mergeBlock := fn.Ptr.NewBlock(mod.GenerateID("match.merge"))
+
+	// every variant is handled, so the tag can't take another value
+	if defaultBlock == nil {
+		defaultBlock = fn.Ptr.NewBlock(mod.GenerateID("match.unreachable"))
+		defaultBlock.NewUnreachable()
+	}
+
+	bb.NewSwitch(tag, defaultBlock, cases...)
+
+	// break jumps out of the match, continue goes to the enclosing loop
+	if err := fn.PushLoop(&LoopTarget{Break: mergeBlock}); err != nil {
+		return pkg.WithPos(err, m.Scope.Current().File, m.Pos)
+	}
+
+	for i, a := range m.Arms {
+		m.Scope.SetBasicBlock(blocks[i])
+
+		// the binding is a copy of the payload, local to the arm
+		if a.Binding != "" {
+			_, field, _ := ut.FindField(a.Variant)
+
+			fieldIRType, err := field.Type.IRType()
+			if err != nil {
+				return err
+			}
+
+			addr, err := unionPayload(m.Scope, ut, irType, ptr, field.Type)
+			if err != nil {
+				return err
+			}
+
+			local := m.Scope.BasicBlock().NewAlloca(fieldIRType)
+			m.Scope.BasicBlock().NewStore(m.Scope.BasicBlock().NewLoad(fieldIRType, addr), local)
+
+			err = a.Body.AddLocal(&Variable{
+				Ident: a.Binding,
+				Type:  field.Type,
+				Ptr:   local,
+				Pos:   a.Pos,
+			})
+			if err != nil {
+				return pkg.WithPos(err, m.Scope.Current().File, a.Pos)
+			}
+		}
+
+		if err := a.Body.Generate(); err != nil {
+			return err
+		}
+
+		// no fallthrough, every arm ends the match
+		if m.Scope.BasicBlock().Term == nil {
+			m.Scope.BasicBlock().NewBr(mergeBlock)
+		}
+	}
+
+	fn.PopLoop()
+
+	m.Scope.SetBasicBlock(mergeBlock)
+
+	return nil
+}
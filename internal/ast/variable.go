@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/llir/llvm/ir/constant"
 	"github.com/llir/llvm/ir/value"
 )
 
@@ -11,14 +12,21 @@ type Variable struct {
 	Ident   string
 	Type    *Type
 	IsParam bool
+	IsConst bool
 
 	// LLVM IR pointer to the variable
 	Ptr value.Value
+	// value of a constant, used instead of loading it
+	Constant constant.Constant
 
 	Pos lexer.Position
 }
 
 func (v *Variable) String() string {
+	if v.IsConst {
+		return "const " + v.Type.String() + " " + v.Ident
+	}
+
 	return v.Type.String() + " " + v.Ident
 }
 
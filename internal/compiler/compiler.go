@@ -7,7 +7,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/Astemirdum/si/internal/ast"
 	"github.com/Astemirdum/si/internal/parser"
 	"github.com/Astemirdum/si/pkg"
 	"github.com/llir/llvm/ir"
@@ -46,8 +45,9 @@ func (c *Compiler) Destroy() {
 	}
 }
 
-func (c *Compiler) runClang(srcFilePath, binaryFilePath string) (string, error) {
-	cmd := exec.Command(c.clangPath, "-Werror", "-Wno-override-module", "-o", binaryFilePath, srcFilePath) //nolint:gosec
+func (c *Compiler) runClang(binaryFilePath string, srcFilePaths ...string) (string, error) {
+	args := append([]string{"-Werror", "-Wno-override-module", "-o", binaryFilePath}, srcFilePaths...)
+	cmd := exec.Command(c.clangPath, args...) //nolint:gosec
 	out, err := cmd.CombinedOutput()
 
 	return string(out), err
@@ -64,36 +64,50 @@ func (c *Compiler) RunProgramSi(src string, opts ...Option) (string, error) {
 	basename := OverrideBasename("main", opts...)
 
 	input := pkg.NewFile(basename, src)
-	scope := ast.NewScope(input)
 
-	// parsing src to AST
-	parsedAst, err := c.parser.ParseFile(input)
+	// parsing src and the files it imports to AST
+	l := newLoader(c.parser, SourceFiles(opts))
+
+	transformedAst, err := l.load(input)
 	if err != nil {
-		return "", NewParseError(err, src)
+		return "", err
 	}
-	transformedAst := parsedAst.Transform(scope)
 
 	// AST -> generate LLVM
 	bitCode, err := transformedAst.Generate()
 	if err != nil {
-		return "", NewGenerateError(err, src)
+		// print the file the error is in, which can be an imported one
+		return "", NewGenerateError(err, l.source(err, src))
 	}
 
 	bitCodeStr := bitCode.String()
 
 	//fmt.Println(bitCodeStr)
 
-	srcFilePath := filepath.Join(c.tmpFolder, fmt.Sprintf("%s.ll", basename))
+	srcFilePath := filepath.Join(c.tmpFolder, fmt.Sprintf("%s.ll", filepath.Base(basename)))
 
 	err = os.WriteFile(srcFilePath, []byte(bitCodeStr), 0600)
 	if err != nil {
 		return "", err
 	}
 
-	binaryFilePath := filepath.Join(c.tmpFolder, fmt.Sprintf("%s.bin", basename))
+	srcFilePaths := []string{srcFilePath}
+
+	for i, lib := range LinkedC(opts) {
+		libFilePath := filepath.Join(c.tmpFolder, fmt.Sprintf("%s_lib%d.c", filepath.Base(basename), i))
+
+		err = os.WriteFile(libFilePath, []byte(lib), 0600)
+		if err != nil {
+			return "", err
+		}
+
+		srcFilePaths = append(srcFilePaths, libFilePath)
+	}
+
+	binaryFilePath := filepath.Join(c.tmpFolder, fmt.Sprintf("%s.bin", filepath.Base(basename)))
 
-	// compile llvm
-	result, err := c.runClang(srcFilePath, binaryFilePath)
+	// compile llvm together with the linked C sources
+	result, err := c.runClang(binaryFilePath, srcFilePaths...)
 	if err != nil {
 		return "", NewClangRunError(err, src, result)
 	}
@@ -119,7 +133,7 @@ func (c *Compiler) RunProgramC(src string, opts ...Option) (string, error) {
 
 	binaryFilePath := filepath.Join(c.tmpFolder, fmt.Sprintf("%s.bin", file))
 
-	result, err := c.runClang(srcFilePath, binaryFilePath)
+	result, err := c.runClang(binaryFilePath, srcFilePath)
 	if err != nil {
 		return "", NewClangRunError(err, src, result)
 	}
@@ -152,7 +166,7 @@ func (c *Compiler) RunProgramLL(m *ir.Module, opts []Option) (string, error) {
 
 	binaryFilePath := filepath.Join(c.tmpFolder, fmt.Sprintf("%s.bin", file))
 
-	result, err := c.runClang(srcFilePath, binaryFilePath)
+	result, err := c.runClang(binaryFilePath, srcFilePath)
 	if err != nil {
 		return "", NewClangRunError(err, src, result)
 	}
@@ -68,3 +68,19 @@ func NewBinaryRunError(err error, source string) *BinaryRunError {
 func (bre *BinaryRunError) Error() string {
 	return fmt.Sprintf("binary error: %s\nresult:\n%s\nsource:\n%s\n", bre.Err.Error(), bre.Result, bre.Source)
 }
+
+type ImportError struct {
+	Err    error
+	Source string
+}
+
+func NewImportError(err error, source string) *ImportError {
+	return &ImportError{
+		Err:    err,
+		Source: source,
+	}
+}
+
+func (ie *ImportError) Error() string {
+	return fmt.Sprintf("import error: %s\nsource:\n%s\n", ie.Err.Error(), ie.Source)
+}
@@ -0,0 +1,104 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/Astemirdum/si/internal/ast"
+	"github.com/Astemirdum/si/internal/parser"
+	"github.com/Astemirdum/si/pkg"
+)
+
+// loader parses a program file and, recursively, the files it imports. Every file is
+// parsed once, even if several files import it, and gets a scope of its own.
+type loader struct {
+	parser  *parser.Parser
+	files   map[string]string
+	modules map[string]*ast.Module
+	// sources are the contents of the loaded files, to print the file an error is in
+	sources map[string]string
+
+	// files being loaded, the last one is the innermost import
+	loading []string
+}
+
+func newLoader(p *parser.Parser, files map[string]string) *loader {
+	return &loader{
+		parser:  p,
+		files:   files,
+		modules: map[string]*ast.Module{},
+		sources: map[string]string{},
+	}
+}
+
+func (l *loader) load(file *pkg.File) (*ast.Module, error) {
+	l.sources[file.Name] = file.Contents
+
+	parsedAst, err := l.parser.ParseFile(file)
+	if err != nil {
+		return nil, NewParseError(err, file.Contents)
+	}
+
+	module := parsedAst.Transform(ast.NewScope(file))
+	l.modules[file.Name] = module
+
+	l.loading = append(l.loading, file.Name)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	for _, imp := range module.Imports {
+		// imports are relative to the importing file
+		name := path.Join(path.Dir(file.Name), imp.Path)
+
+		if i := slices.Index(l.loading, name); i != -1 {
+			cycle := strings.Join(append(slices.Clone(l.loading[i:]), name), " -> ")
+			return nil, NewImportError(pkg.WithPos(fmt.Errorf("import cycle: %s", cycle), file, imp.Pos), file.Contents)
+		}
+
+		if imported, ok := l.modules[name]; ok {
+			imp.Module = imported
+			continue
+		}
+
+		src, err := l.read(name)
+		if err != nil {
+			return nil, NewImportError(pkg.WithPos(err, file, imp.Pos), file.Contents)
+		}
+
+		imported, err := l.load(pkg.NewFile(name, src))
+		if err != nil {
+			return nil, err
+		}
+
+		imp.Module = imported
+	}
+
+	return module, nil
+}
+
+// source returns the contents of the file err is positioned in, or src if it has no position.
+func (l *loader) source(err error, src string) string {
+	if file := pkg.FileOf(err); file != nil {
+		if contents, ok := l.sources[file.Name]; ok {
+			return contents
+		}
+	}
+
+	return src
+}
+
+// read returns the source of an imported file, from the files given to the compiler or from disk.
+func (l *loader) read(name string) (string, error) {
+	if src, ok := l.files[name]; ok {
+		return src, nil
+	}
+
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("cannot import %s: %w", name, err)
+	}
+
+	return string(src), nil
+}
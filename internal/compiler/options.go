@@ -60,3 +60,37 @@ func JoinDeclares(opts []Option) string {
 
 	return strings.Join(declares, "\n")
 }
+
+type OptionLinkC struct{ Src string }
+
+// LinkC compiles a C source together with the program, so the program and the C code can call each other.
+func LinkC(src string) *OptionLinkC { return &OptionLinkC{Src: src} }
+func (o *OptionLinkC) Option()      {}
+
+func LinkedC(opts []Option) []string {
+	var srcs []string
+	for _, o := range opts {
+		if ol, ok := o.(*OptionLinkC); ok {
+			srcs = append(srcs, ol.Src)
+		}
+	}
+
+	return srcs
+}
+
+type OptionFile struct{ Name, Src string }
+
+// File adds a source file that the program can import by name, instead of reading it from disk.
+func File(name, src string) *OptionFile { return &OptionFile{Name: name, Src: src} }
+func (o *OptionFile) Option()           {}
+
+func SourceFiles(opts []Option) map[string]string {
+	files := map[string]string{}
+	for _, o := range opts {
+		if of, ok := o.(*OptionFile); ok {
+			files[of.Name] = of.Src
+		}
+	}
+
+	return files
+}
@@ -57,6 +57,22 @@ func (suite *Suite) EqualProgramSi(src, expected string, opts ...Option) {
 	suite.Equal(expected, result)
 }
 
+// EqualProgramSiC checks C interop: src linked with the C library lib must print
+// the same as the C program made of lib and cMain.
+func (suite *Suite) EqualProgramSiC(src, lib, cMain string, opts ...Option) {
+	c := NewCompiler()
+	defer c.Destroy()
+
+	expected, err := c.RunProgramC(lib+cMain, Basename("expected"))
+	suite.NoError(err)
+	suite.NotEmpty(expected)
+
+	result, err := c.RunProgramSi(src, append(opts, LinkC(lib))...)
+	suite.NoError(err)
+
+	suite.Equal(expected, result)
+}
+
 func (suite *Suite) ErrorGenerateProgramSi(src, contains string, opts ...Option) {
 	c := NewCompiler()
 	defer c.Destroy()
@@ -67,6 +83,16 @@ func (suite *Suite) ErrorGenerateProgramSi(src, contains string, opts ...Option)
 	suite.Contains(err.Error(), contains)
 }
 
+func (suite *Suite) ErrorImportProgramSi(src, contains string, opts ...Option) {
+	c := NewCompiler()
+	defer c.Destroy()
+
+	_, err := c.RunProgramSi(src, opts...)
+	ie := &ImportError{}
+	suite.ErrorAs(err, &ie)
+	suite.Contains(err.Error(), contains)
+}
+
 func (suite *Suite) EqualExprSi(expr, format, expected string, opts ...Option) {
 	src := ExprToProgramSi(expr, format, opts)
 	suite.EqualProgramSi(src, expected, opts...)
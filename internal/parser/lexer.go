@@ -10,10 +10,16 @@ func BuildLexer() *lexer.StatefulDefinition {
 			{Name: "Null", Pattern: `NULL`, Action: nil},
 			{Name: `StringStart`, Pattern: `"`, Action: lexer.Push("String")},
 			{Name: `CharStart`, Pattern: `'`, Action: lexer.Push("Char")},
-			{Name: "Number", Pattern: `(\d*\.)?\d+`, Action: nil},
+			// an element of a tuple, e.g. the .0 of t.0, it must come before Number
+			{Name: "TupleIndex", Pattern: `\.\d+\b`, Action: nil},
+			// hex, octal and binary integers, then decimal integers and floats, all with an optional type suffix
+			{Name: "Number", Pattern: `(0[xX][\da-fA-F_]+|0[oO][0-7_]+|0[bB][01_]+|(\d[\d_]*)?\.?\d[\d_]*([eE][-+]?\d+)?)([iu](8|16|32|64)|f(32|64))?`, Action: nil},
 			{Name: "BasicType", Pattern: `\b(bool|void|i8|i16|i32|i64|u8|u16|u32|u64|f32|f64)\b`, Action: nil},
-			{Name: "Keyword", Pattern: `\b(if|else|while|for|type|return|continue|break|sizeof|const|struct)\b`, Action: nil},
+			{Name: "Keyword", Pattern: `\b(if|else|do|while|for|switch|case|default|type|return|continue|break|sizeof|const|struct|enum|union|match|import|export|interface)\b`, Action: nil},
 			{Name: "Ident", Pattern: `\w+`, Action: nil},
+			// logical operators are lexed as a single token, otherwise "a | b" and "a || b" are ambiguous
+			{Name: "LogicalOp", Pattern: `&&|\|\|`, Action: nil},
+			{Name: "AssignOp", Pattern: `(<<|>>|[-+*/%&|^])=`, Action: nil},
 			{Name: "Punct", Pattern: `[-[!@#$%^&*()+_={}\|:;"'<,>.?/]|]`, Action: nil},
 			{Name: "Whitespace", Pattern: `[\n\r\s]+`, Action: nil},
 		},
@@ -23,6 +29,7 @@ func BuildLexer() *lexer.StatefulDefinition {
 			{Name: "Chars", Pattern: `[^"\\]+`, Action: nil},
 		},
 		"Char": {
+			{Name: "Escaped", Pattern: `\\.`, Action: nil},
 			{Name: "CharEnd", Pattern: `'`, Action: lexer.Pop()},
 			{Name: "SingleChar", Pattern: `[^'\\]{1}`, Action: nil},
 		},
@@ -454,3 +454,73 @@ func (suite *LexerTestSuite) TestPrefixExpr() {
 	suite.EqualToken(tokens, "Punct", `-`)
 	suite.EqualToken(tokens, "Punct", `-`)
 }
+
+func (suite *LexerTestSuite) TestLogicalOp() {
+	tokens, err := suite.lexer.LexString("main.c", `a||b|c&&d&e`)
+	suite.NoError(err)
+
+	suite.EqualToken(tokens, "Ident", `a`)
+	suite.EqualToken(tokens, "LogicalOp", `||`)
+	suite.EqualToken(tokens, "Ident", `b`)
+	suite.EqualToken(tokens, "Punct", `|`)
+	suite.EqualToken(tokens, "Ident", `c`)
+	suite.EqualToken(tokens, "LogicalOp", `&&`)
+	suite.EqualToken(tokens, "Ident", `d`)
+	suite.EqualToken(tokens, "Punct", `&`)
+	suite.EqualToken(tokens, "Ident", `e`)
+}
+
+func (suite *LexerTestSuite) TestAssignOp() {
+	tokens, err := suite.lexer.LexString("main.c", `a+=b<<=c<=d`)
+	suite.NoError(err)
+
+	suite.EqualToken(tokens, "Ident", `a`)
+	suite.EqualToken(tokens, "AssignOp", `+=`)
+	suite.EqualToken(tokens, "Ident", `b`)
+	suite.EqualToken(tokens, "AssignOp", `<<=`)
+	suite.EqualToken(tokens, "Ident", `c`)
+	suite.EqualToken(tokens, "Punct", `<`)
+	suite.EqualToken(tokens, "Punct", `=`)
+	suite.EqualToken(tokens, "Ident", `d`)
+}
+
+func (suite *LexerTestSuite) TestNumber() {
+	tokens, err := suite.lexer.LexString("main.c", `0xFF 0o17 0b1010 1_000_000 1.5e-3 .5e1 10u8 3.0f32 0x1Fi64 2E10f64 7x .5 t.0.1`)
+	suite.NoError(err)
+
+	for _, number := range []string{`0xFF`, `0o17`, `0b1010`, `1_000_000`, `1.5e-3`, `.5e1`, `10u8`, `3.0f32`, `0x1Fi64`, `2E10f64`} {
+		suite.EqualToken(tokens, "Number", number)
+		suite.EqualToken(tokens, "Whitespace", ` `)
+	}
+
+	suite.EqualToken(tokens, "Number", `7`)
+	suite.EqualToken(tokens, "Ident", `x`)
+	suite.EqualToken(tokens, "Whitespace", ` `)
+
+	// a fraction without an integer part is parsed as a number too
+	suite.EqualToken(tokens, "TupleIndex", `.5`)
+	suite.EqualToken(tokens, "Whitespace", ` `)
+	suite.EqualToken(tokens, "Ident", `t`)
+	suite.EqualToken(tokens, "TupleIndex", `.0`)
+	suite.EqualToken(tokens, "TupleIndex", `.1`)
+}
+
+func (suite *LexerTestSuite) TestEscape() {
+	tokens, err := suite.lexer.LexString("main.c", `'\'' '\0' "a\"\u{1F600}"`)
+	suite.NoError(err)
+
+	suite.EqualToken(tokens, "CharStart", `'`)
+	suite.EqualToken(tokens, "Escaped", `\'`)
+	suite.EqualToken(tokens, "CharEnd", `'`)
+	suite.EqualToken(tokens, "Whitespace", ` `)
+	suite.EqualToken(tokens, "CharStart", `'`)
+	suite.EqualToken(tokens, "Escaped", `\0`)
+	suite.EqualToken(tokens, "CharEnd", `'`)
+	suite.EqualToken(tokens, "Whitespace", ` `)
+	suite.EqualToken(tokens, "StringStart", `"`)
+	suite.EqualToken(tokens, "Chars", `a`)
+	suite.EqualToken(tokens, "Escaped", `\"`)
+	suite.EqualToken(tokens, "Escaped", `\u`)
+	suite.EqualToken(tokens, "Chars", `{1F600}`)
+	suite.EqualToken(tokens, "StringEnd", `"`)
+}
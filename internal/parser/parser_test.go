@@ -1,9 +1,11 @@
 package parser_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/Astemirdum/si/internal/parser"
+	"github.com/Astemirdum/si/pkg"
 
 	"github.com/Astemirdum/si/internal/ast"
 	"github.com/alecthomas/participle/v2/lexer"
@@ -58,7 +60,7 @@ func (suite *ParserTestSuite) TestString() {
 
 	cop := expr.Transform(&ast.Block{})
 	suite.Equal(&ast.ConstantStringOp{
-		Constant: "he\"l\tlo",
+		Constant: `he\"l\tlo`,
 		Scope:    &ast.Block{},
 		Pos:      lexer.Position{Filename: "main.c", Offset: 0, Line: 1, Column: 1},
 	}, cop)
@@ -409,3 +411,287 @@ func (suite *ParserTestSuite) TestStruct() {
 	`)
 	suite.NoError(err)
 }
+
+func (suite *ParserTestSuite) TestGlobal() {
+	p := parser.BuildParser[parser.Module]()
+
+	result, err := p.ParseString("main.c", `
+	i64 printf(i8 *fmt, ...);
+
+	i64 counter = 0;
+	const i64 limit = 10;
+	[4]i64 table;
+
+	i64 main() {
+		return counter;
+	}
+	`)
+	suite.NoError(err)
+	suite.Len(result.Globals, 3)
+	suite.Len(result.Functions, 2)
+	suite.True(result.Globals[1].Const)
+	suite.Nil(result.Globals[2].Expr)
+}
+
+func (suite *ParserTestSuite) TestLabel() {
+	p := parser.BuildParser[parser.WhileStmt]()
+
+	result, err := p.ParseString("main.c", `
+	outer: while (x > 0) {
+		for (y = 0; y < 10; y++;) {
+			break outer;
+		}
+	}`)
+	suite.NoError(err)
+	suite.Equal("outer", result.Label)
+	suite.Equal("outer", result.Body.CompoundStmt.Stmts[0].ForStmt.Body.CompoundStmt.Stmts[0].BreakStmt.Ident)
+}
+
+func (suite *ParserTestSuite) TestSwitch() {
+	p := parser.BuildParser[parser.SwitchStmt]()
+
+	result, err := p.ParseString("main.c", `
+	switch (x) {
+	case 1:
+		y = 1;
+		break;
+	case 'a':
+	default:
+		y = 2;
+	}`)
+	suite.NoError(err)
+	suite.Len(result.Cases, 3)
+	suite.Len(result.Cases[0].Stmts, 2)
+	suite.Empty(result.Cases[1].Stmts)
+	suite.True(result.Cases[2].Default)
+}
+
+func (suite *ParserTestSuite) TestGrouping() {
+	p := parser.BuildParser[parser.Expr]()
+
+	for src, expected := range map[string]string{
+		"(1 << 62) * 4":       "(1 << 62) * 4",
+		"a - (b - c) + d * e": "load(a) - (load(b) - load(c)) + load(d) * load(e)",
+		"-(a + b) / c":        "- (load(a) + load(b)) / load(c)",
+		"a || b && (c || d)":  "load(a) || load(b) && (load(c) || load(d))",
+	} {
+		expr, err := p.ParseString("main.c", src)
+		suite.NoError(err)
+
+		suite.Equal(expected, expr.Transform(&ast.Block{}).String())
+	}
+}
+
+func (suite *ParserTestSuite) TestConditional() {
+	p := parser.BuildParser[parser.Expr]()
+
+	expr, err := p.ParseString("main.c", "a ? b : c ? d : e")
+	suite.NoError(err)
+
+	transformed := expr.Transform(&ast.Block{})
+	suite.Equal("load(a) ? load(b) : load(c) ? load(d) : load(e)", transformed.String())
+
+	cond := transformed.(*ast.ConditionalOp)
+	suite.IsType(&ast.ConditionalOp{}, cond.Else)
+}
+
+func (suite *ParserTestSuite) TestArrayLiteral() {
+	p := parser.BuildParser[parser.DeclStmt]()
+
+	decl, err := p.ParseString("main.c", "[2][3]i64 a = {{1, 2, 3}, {4,},};")
+	suite.NoError(err)
+
+	transformed := decl.Transform(&ast.Block{}).(*ast.DeclStmt)
+	suite.Equal("[2][3]i64", transformed.Type.String())
+	suite.Equal("{{1, 2, 3}, {4}}", transformed.Expr.String())
+}
+
+func (suite *ParserTestSuite) TestFunctionType() {
+	p := parser.BuildParser[parser.DeclStmt]()
+
+	decl, err := p.ParseString("main.c", "fn(i8*, ...) -> i64 f = s->cb;")
+	suite.NoError(err)
+
+	transformed := decl.Transform(&ast.Block{}).(*ast.DeclStmt)
+	suite.Equal("fn(i8*, ...) -> i64", transformed.Type.String())
+
+	e := parser.BuildParser[parser.Expr]()
+
+	expr, err := e.ParseString("main.c", "ops[i](a, b)(c)")
+	suite.NoError(err)
+	suite.Equal("load(ops)[load(i)](load(a), load(b))(load(c))", expr.Transform(&ast.Block{}).String())
+}
+
+func (suite *ParserTestSuite) TestEnum() {
+	p := parser.BuildParser[parser.TypeDef]()
+
+	td, err := p.ParseString("main.c", "type enum { RED, GREEN = 5, BLUE, NEG = -2, NEXT } Color;")
+	suite.NoError(err)
+	suite.Equal("Color", td.Ident)
+
+	typ := td.Type.Transform(&ast.Block{})
+	suite.Equal("enum { RED = 0, GREEN = 5, BLUE = 6, NEG = -2, NEXT = -1, }", typ.String())
+}
+
+func (suite *ParserTestSuite) TestUnion() {
+	p := parser.BuildParser[parser.TypeDef]()
+
+	td, err := p.ParseString("main.c", "type tagged union { i64 Int, union { f32 f, u32 u, } Raw, } Value;")
+	suite.NoError(err)
+	suite.Equal("tagged union { Int i64, Raw union { f f32, u u32, }, }", td.Type.Transform(&ast.Block{}).String())
+}
+
+func (suite *ParserTestSuite) TestMatch() {
+	p := parser.BuildParser[parser.MatchStmt]()
+
+	_, err := p.ParseString("main.c", `
+	match (v) {
+	case Int i:
+		x = i;
+	case Real:
+	default:
+		break;
+	}`)
+	suite.NoError(err)
+}
+
+func (suite *ParserTestSuite) TestDoWhile() {
+	p := parser.BuildParser[parser.DoWhileStmt]()
+
+	_, err := p.ParseString("main.c", `
+	do {
+		x++;
+	} while (x < 10);`)
+	suite.NoError(err)
+}
+
+func (suite *ParserTestSuite) TestImport() {
+	p := parser.NewParser()
+
+	m, err := p.ParseFile(pkg.NewFile("main.si", `
+import "lib/list.si";
+
+export type struct { i64 data, } Node;
+export const i64 EMPTY = -1;
+i64 count = 0;
+export i64 sum(Node* head) { return 0; }
+i64 helper() { return 0; }
+`))
+	suite.NoError(err)
+
+	suite.Len(m.Imports, 1)
+	suite.Equal([]string{"lib/list.si"}, m.Imports[0].Path.Parts)
+	suite.True(m.TypeDefs[0].Export)
+	suite.True(m.Globals[0].Export)
+	suite.False(m.Globals[1].Export)
+	suite.True(m.Functions[0].Export)
+	suite.False(m.Functions[1].Export)
+
+	// imports must come first
+	_, err = p.ParseFile(pkg.NewFile("main.si", `i64 count = 0; import "lib/list.si";`))
+	suite.Error(err)
+}
+
+func (suite *ParserTestSuite) TestGeneric() {
+	p := parser.NewParser()
+
+	m, err := p.ParseFile(pkg.NewFile("main.si", `
+type struct<K, V> { K key, V value, } Pair;
+T max<T>(T a, T b) { return a; }
+i64 main() { Pair<i8, Pair<i64, f64>*> p; return max<i64>(1, 2) + max(3, 4); }
+`))
+	suite.NoError(err)
+
+	suite.Equal("K", m.TypeDefs[0].Type.Struct.TypeParams[0].Ident)
+	suite.Equal("V", m.TypeDefs[0].Type.Struct.TypeParams[1].Ident)
+	suite.Equal("T", m.Functions[0].TypeParams[0].Ident)
+
+	// comparisons are not type arguments
+	e, err := parser.BuildParser[parser.Expr]().ParseString("main.c", "f(a < b, c > d)")
+	suite.NoError(err)
+	suite.Equal("f(load(a) < load(b), load(c) > load(d))", e.Transform(&ast.Block{}).String())
+}
+
+func (suite *ParserTestSuite) TestInterface() {
+	p := parser.NewParser()
+
+	m, err := p.ParseFile(pkg.NewFile("main.si", `
+type interface { f64 area(), void scale(f64 by), } Shape;
+type interface<T> { bool less(T* o), } Ordered;
+type interface {} Any;
+void sort<T: Ordered<T>, U>(T* xs, i64 n) { return; }
+`))
+	suite.NoError(err)
+
+	shape := m.TypeDefs[0].Type.Interface
+	suite.Len(shape.Methods, 2)
+	suite.Equal("area", shape.Methods[0].Ident)
+	suite.Equal("by", shape.Methods[1].Params[0].Ident)
+	suite.Equal("T", m.TypeDefs[1].Type.Interface.TypeParams[0].Ident)
+	suite.Empty(m.TypeDefs[2].Type.Interface.Methods)
+
+	params := m.Functions[0].TypeParams
+	suite.Equal("Ordered", params[0].Bound.Alias)
+	suite.Nil(params[1].Bound)
+
+	module := m.Transform(ast.NewScope(pkg.NewFile("main.si", "")))
+	suite.Equal([]string{"type interface { f64 area(), void scale(f64), } Shape"}, module.LocalTypes[0].String())
+}
+
+func (suite *ParserTestSuite) TestLambda() {
+	p := parser.NewParser()
+
+	m, err := p.ParseFile(pkg.NewFile("main.si", `
+closure(i64) -> i64 adder(i64 n) { return fn(i64 x) -> i64 { return x + n; }; }
+i64 main() {
+	i64 sum = 0;
+	closure() -> void f = fn [&sum, n] () -> void { sum += 1; return; };
+	return fn(i64 a, i64 b) -> i64 { return a + b; }(1, 2) + fn(3);
+}
+`))
+	suite.NoError(err)
+
+	suite.True(m.Functions[0].Declarator.Type.Func.Closure)
+
+	module := m.Transform(ast.NewScope(pkg.NewFile("main.si", "")))
+	suite.Equal("closure(i64) -> i64", module.Functions[0].ReturnType.String())
+
+	body := strings.Join(module.Functions[1].String(), "\n")
+	suite.Contains(body, "fn [&sum, n] () -> void { assign load(sum) += 1; return; }")
+	// fn(3) is still a call of a function named fn
+	suite.Contains(body, "fn(3)")
+}
+
+func (suite *ParserTestSuite) TestTuple() {
+	p := parser.NewParser()
+
+	m, err := p.ParseFile(pkg.NewFile("main.si", `
+(i64, (bool, f64)) f() { return 1, (true, 2.5); }
+i64 main() {
+	i64 q, bool r = g();
+	(i64, i64)* p;
+	return f().1.0 + (a + b) * c + (i64)x;
+}
+`))
+	suite.NoError(err)
+
+	suite.Len(m.Functions[0].Declarator.Type.Tuple, 2)
+
+	module := m.Transform(ast.NewScope(pkg.NewFile("main.si", "")))
+	suite.Equal("(i64, (bool, f64))", module.Functions[0].ReturnType.String())
+
+	body := strings.Join(module.Functions[1].String(), "\n")
+	suite.Contains(body, "decl i64 q, bool r = g();")
+	suite.Contains(body, "decl (i64, i64)* p;")
+	suite.Contains(body, "f().1.0")
+	suite.Contains(strings.Join(module.Functions[0].String(), "\n"), "return (1, (true, 2.5));")
+
+	// an element must follow a dot
+	_, err = p.ParseFile(pkg.NewFile("main.si", `
+i64 main() {
+	(i64, i64) t = (1, 2);
+	return t 1;
+}
+`))
+	suite.Error(err)
+}
@@ -5,21 +5,42 @@ import "github.com/alecthomas/participle/v2/lexer"
 // MODULE, FUNCTIONS
 
 type Module struct {
-	TypeDefs  []*TypeDef  `@@*`
-	Functions []*Function `@@*`
+	Imports   []*Import   `@@*`
+	TypeDefs  []*TypeDef  `( @@`
+	Functions []*Function `| @@`
+	Globals   []*Global   `| @@ )*`
+
+	Pos lexer.Position
+}
+
+type Import struct {
+	Path *InternalString `"import" StringStart @@ StringEnd ";"`
 
 	Pos lexer.Position
 }
 
 type TypeDef struct {
-	Type  *Type  `"type" @@ `
-	Ident string `@Ident ";"`
+	Export bool   `@"export"?`
+	Type   *Type  `"type" @@ `
+	Ident  string `@Ident ";"`
+
+	Pos lexer.Position
+}
+
+type Global struct {
+	Export     bool        `@"export"?`
+	Const      bool        `@"const"?`
+	Declarator *Declarator `@@`
+	Expr       *Expr       `[ "=" @@ ] ";"`
 
 	Pos lexer.Position
 }
 
 type Function struct {
-	Declarator  *Declarator   `@@ "("`
+	Export      bool          `@"export"?`
+	Declarator  *Declarator   `@@`
+	Method      string        `( "." @Ident )?`
+	TypeParams  []*TypeParam  `( "<" @@ ( "," @@ )* ">" )? "("`
 	Params      []*Declarator `( @@ ( "," @@ )* )?`
 	Variadic    bool          `@( "," "." "." "." )? ")"`
 	Body        *CompoundStmt `( @@`
@@ -46,7 +67,10 @@ type Stmt struct {
 	CompoundStmt *CompoundStmt `| @@`
 	IfStmt       *IfStmt       `| @@`
 	WhileStmt    *WhileStmt    `| @@`
+	DoWhileStmt  *DoWhileStmt  `| @@`
 	ForStmt      *ForStmt      `| @@`
+	SwitchStmt   *SwitchStmt   `| @@`
+	MatchStmt    *MatchStmt    `| @@`
 
 	Pos lexer.Position
 }
@@ -58,33 +82,38 @@ type ExprStmt struct {
 }
 
 type DeclStmt struct {
+	Const      bool        `@"const"?`
 	Declarator *Declarator `@@`
-	Expr       *Expr       `[ "=" @@ ] ";"`
+	// Rest are the other variables of a destructuring declaration, e.g. i64 q, i64 r = divmod(a, b);
+	Rest []*Declarator `( "," @@ )*`
+	Expr *Expr         `[ "=" @@ ] ";"`
 
 	Pos lexer.Position
 }
 
 type AssignStmt struct {
-	Left  *Expr `@@`
-	Right *Expr `"=" @@ ";"`
+	Left  *Expr  `@@`
+	Op    string `@( AssignOp | "=" )`
+	Right *Expr  `@@ ";"`
 
 	Pos lexer.Position
 }
 
 type ReturnStmt struct {
-	Expr *Expr `"return" @@? ";"`
+	// more than one expression return a tuple
+	Exprs []*Expr `"return" ( @@ ( "," @@ )* )? ";"`
 
 	Pos lexer.Position
 }
 
 type ContinueStmt struct {
-	Ident string `"continue" ";"`
+	Ident string `"continue" @Ident? ";"`
 
 	Pos lexer.Position
 }
 
 type BreakStmt struct {
-	Ident string `"break" ";"`
+	Ident string `"break" @Ident? ";"`
 
 	Pos lexer.Position
 }
@@ -98,14 +127,25 @@ type IfStmt struct {
 }
 
 type WhileStmt struct {
-	Condition *Expr `"while" "(" @@ ")"`
-	Body      *Stmt `@@`
+	Label     string `( @Ident ":" )?`
+	Condition *Expr  `"while" "(" @@ ")"`
+	Body      *Stmt  `@@`
+
+	Pos lexer.Position
+}
+
+type DoWhileStmt struct {
+	Label     string `( @Ident ":" )?`
+	Body      *Stmt  `"do" @@`
+	Condition *Expr  `"while" "(" @@ ")" ";"`
 
 	Pos lexer.Position
 }
 
 type ForStmt struct {
-	Init       *AssignStmt `"for" "(" @@`
+	Label      string      `( @Ident ":" )?`
+	Init       *AssignStmt `"for" "(" ( @@`
+	ExprInit   *ExprStmt   `| @@ )`
 	Condition  *Expr       `@@ ";"`
 	ExprPost   *ExprStmt   `( @@ ")"`
 	AssignPost *AssignStmt `| @@ ")" )`
@@ -114,18 +154,65 @@ type ForStmt struct {
 	Pos lexer.Position
 }
 
+type SwitchStmt struct {
+	Expr  *Expr         `"switch" "(" @@ ")" "{"`
+	Cases []*SwitchCase `@@* "}"`
+
+	Pos lexer.Position
+}
+
+type SwitchCase struct {
+	Value   *Expr   `( "case" @@`
+	Default bool    `| @"default" ) ":"`
+	Stmts   []*Stmt `@@*`
+
+	Pos lexer.Position
+}
+
+type MatchStmt struct {
+	Expr *Expr       `"match" "(" @@ ")" "{"`
+	Arms []*MatchArm `@@* "}"`
+
+	Pos lexer.Position
+}
+
+type MatchArm struct {
+	Variant string  `( "case" @Ident`
+	Binding string  `@Ident?`
+	Default bool    `| @"default" ) ":"`
+	Stmts   []*Stmt `@@*`
+
+	Pos lexer.Position
+}
+
 // EXPRESSIONS
 
 type Expr struct {
-	LogicalExpr *LogicalExpr `@@`
+	ConditionalExpr *ConditionalExpr `@@`
+
+	Pos lexer.Position
+}
+
+type ConditionalExpr struct {
+	Condition *LogicalExpr     `@@`
+	Then      *Expr            `[ "?" @@`
+	Else      *ConditionalExpr `":" @@ ]`
 
 	Pos lexer.Position
 }
 
 type LogicalExpr struct {
+	Left  *LogicalAndExpr `@@`
+	Op    string          `[ @"||"`
+	Right *LogicalExpr    `@@ ]`
+
+	Pos lexer.Position
+}
+
+type LogicalAndExpr struct {
 	Left  *InclusiveOrExpr `@@`
-	Op    string           `[ @("&" "&" | "|" "|")`
-	Right *LogicalExpr     `@@ ]`
+	Op    string           `[ @"&&"`
+	Right *LogicalAndExpr  `@@ ]`
 
 	Pos lexer.Position
 }
@@ -251,8 +338,11 @@ type PostfixExprTick struct {
 type AccessorExpr struct {
 	Head *IndexExpr `@@`
 	Tail []struct {
-		Op    string `@("-" ">" | ".")`
-		Field string `@Ident`
+		Op    string    `( @("-" ">" | ".")`
+		Field string    `@Ident`
+		Call  *CallArgs `@@?`
+		// an element of a tuple, e.g. t.0
+		Element string `| @TupleIndex )`
 
 		Pos lexer.Position
 	} `@@*`
@@ -263,7 +353,8 @@ type AccessorExpr struct {
 type IndexExpr struct {
 	Head *UnaryExpr `@@`
 	Tail []struct {
-		Index *Expr `'[' @@ ']'`
+		Index *Expr     `'[' @@ ']'`
+		Call  *CallArgs `| @@`
 
 		Pos lexer.Position
 	} `@@*`
@@ -272,15 +363,41 @@ type IndexExpr struct {
 }
 
 type UnaryExpr struct {
-	FnCallExpr  *FnCallExpr  `@@`
+	// LambdaExpr must be before FnCallExpr, because fn() can also be a call
+	LambdaExpr  *LambdaExpr  `@@`
+	FnCallExpr  *FnCallExpr  `| @@`
 	PrimaryExpr *PrimaryExpr `| @@`
 
 	Pos lexer.Position
 }
 
 type FnCallExpr struct {
-	Ident string  `@Ident`
-	Args  []*Expr `"(" (@@ ("," @@)*)? ")"`
+	Ident    string  `@Ident`
+	TypeArgs []*Type `( "<" @@ ( "," @@ )* ">" )?`
+	Args     []*Expr `"(" (@@ ("," @@)*)? ")"`
+
+	Pos lexer.Position
+}
+
+type LambdaExpr struct {
+	Captures   []*Capture    `"fn" ( "[" @@ ( "," @@ )* "]" )? "("`
+	Params     []*Declarator `( @@ ( "," @@ )* )? ")"`
+	ReturnType *Type         `"-" ">" @@`
+	Body       *CompoundStmt `@@`
+
+	Pos lexer.Position
+}
+
+type Capture struct {
+	Reference bool   `@"&"?`
+	Ident     string `@Ident`
+
+	Pos lexer.Position
+}
+
+// CallArgs calls the function value it follows, e.g. ops[i](a, b).
+type CallArgs struct {
+	Args []*Expr `"(" (@@ ("," @@)*)? ")"`
 
 	Pos lexer.Position
 }
@@ -288,22 +405,36 @@ type FnCallExpr struct {
 type StructField struct {
 	Field string `"." @Ident`
 	Expr  *Expr  `"=" @@`
+
+	Pos lexer.Position
 }
 
 type StructExpr struct {
 	Alias        string         `@Ident`
-	StructFields []*StructField `"{" @@ ( "," @@ )* "," "}"`
+	TypeArgs     []*Type        `( "<" @@ ( "," @@ )* ">" )?`
+	StructFields []*StructField `"{" ( @@ ( "," @@ )* ","? )? "}"`
+
+	Pos lexer.Position
+}
+
+type ArrayExpr struct {
+	Elems []*Expr `"{" ( @@ ( "," @@ )* ","? )? "}"`
+
+	Pos lexer.Position
 }
 
 type PrimaryExpr struct {
-	// StructExpr must be before Ident, because StructExpr starts with Ident
+	// StructExpr must be before Ident, because StructExpr starts with Ident.
+	// A fraction without an integer part, e.g. .25, is lexed as a tuple index
 	Struct   *StructExpr     `@@`
+	Array    *ArrayExpr      `| @@`
 	Null     string          `| @Null`
 	Variable string          `| @Ident`
 	Sign     string          `| @("+" | "-")?`
-	Number   string          `@Number`
-	Char     string          `| ( CharStart @SingleChar CharEnd )`
+	Number   string          `@( Number | TupleIndex )`
+	Char     string          `| ( CharStart @( Escaped | SingleChar )+ CharEnd )`
 	String   *InternalString `| ( StringStart @@ StringEnd )`
+	Tuple    []*Expr         `| "(" @@ ( "," @@ )+ ")"`
 	Expr     *Expr           `| "(" @@ ")"`
 
 	Pos lexer.Position
@@ -322,17 +453,66 @@ type Declarator struct {
 	Pos lexer.Position
 }
 
+// TypeParam is a type parameter of a generic function or type, with the interface it must implement.
+type TypeParam struct {
+	Ident string `@Ident`
+	Bound *Type  `( ":" @@ )?`
+}
+
 type Struct struct {
-	Fields []*Declarator `"struct" "{" @@ ( "," @@ )* "," "}"`
+	TypeParams []*TypeParam  `"struct" ( "<" @@ ( "," @@ )* ">" )?`
+	Fields     []*Declarator `"{" @@ ( "," @@ )* "," "}"`
 }
 
-type Type struct {
-	Lengths []int `( "[" @Number "]" )*`
+type Union struct {
+	Tagged bool          `@"tagged"? "union"`
+	Fields []*Declarator `"{" @@ ( "," @@ )* "," "}"`
+}
+
+type Enum struct {
+	Members []*EnumMember `"enum" "{" @@ ( "," @@ )* ","? "}"`
+}
+
+type EnumMember struct {
+	Ident string `@Ident`
+	Value *int   `( "=" @( "-"? Number ) )?`
+
+	Pos lexer.Position
+}
+
+type Interface struct {
+	TypeParams []*TypeParam       `"interface" ( "<" @@ ( "," @@ )* ">" )?`
+	Methods    []*InterfaceMethod `"{" ( @@ "," )* "}"`
+}
+
+type InterfaceMethod struct {
+	ReturnType *Type         `@@`
+	Ident      string        `@Ident "("`
+	Params     []*Declarator `( @@ ( "," @@ )* )? ")"`
+
+	Pos lexer.Position
+}
 
-	Struct *Struct `( @@`
+type FuncType struct {
+	Closure    bool    `( "fn" | @"closure" )`
+	Params     []*Type `"(" ( @@ ( "," @@ )* )?`
+	Variadic   bool    `@( "," "." "." "." )? ")"`
+	ReturnType *Type   `"-" ">" @@`
+}
+
+type Type struct {
+	Lengths []*Expr `( "[" @@ "]" )*`
+
+	Func      *FuncType  `( @@`
+	Struct    *Struct    `| @@`
+	Enum      *Enum      `| @@`
+	Union     *Union     `| @@`
+	Interface *Interface `| @@`
+	Tuple     []*Type    `| "(" @@ ( "," @@ )+ ")"`
 	// must match lexer.go BasicType AND ast.Type
-	Basic string `| @("bool" | "void" | "i8" | "i16" | "i32" | "i64" | "u8" | "u16" | "u32" | "u64" | "f32" | "f64")`
-	Alias string `| @Ident )`
+	Basic    string  `| @("bool" | "void" | "i8" | "i16" | "i32" | "i64" | "u8" | "u16" | "u32" | "u64" | "f32" | "f64")`
+	Alias    string  `| ( @Ident`
+	TypeArgs []*Type `( "<" @@ ( "," @@ )* ">" )? ) )`
 
 	Pointers string `@"*"*`
 
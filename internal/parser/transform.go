@@ -3,6 +3,8 @@ package parser
 import (
 	"strings"
 
+	"github.com/alecthomas/participle/v2/lexer"
+
 	"github.com/Astemirdum/si/internal/ast"
 )
 
@@ -15,10 +17,21 @@ func (m *Module) Transform(scope *ast.Scope) *ast.Module {
 		Pos:            m.Pos,
 	}
 
+	for _, imp := range m.Imports {
+		module.Imports = append(module.Imports, &ast.Import{
+			Path: strings.Join(imp.Path.Parts, ""),
+			Pos:  imp.Pos,
+		})
+	}
+
 	for _, td := range m.TypeDefs {
 		module.LocalTypes = append(module.LocalTypes, td.Transform(module))
 	}
 
+	for _, g := range m.Globals {
+		module.Globals = append(module.Globals, g.Transform(module))
+	}
+
 	for _, f := range m.Functions {
 		module.Functions = append(module.Functions, f.Transform(module))
 	}
@@ -29,13 +42,62 @@ func (m *Module) Transform(scope *ast.Scope) *ast.Module {
 func (t *TypeDef) Transform(scope ast.ScopeLike) *ast.TypeDef {
 	typ := t.Type.Transform(scope)
 
-	return &ast.TypeDef{
-		Alias: t.Ident,
-		Type:  typ,
+	td := &ast.TypeDef{
+		Alias:    t.Ident,
+		Type:     typ,
+		Exported: t.Export,
 	}
+
+	var params []*TypeParam
+	if t.Type.Struct != nil {
+		params = t.Type.Struct.TypeParams
+	} else if t.Type.Interface != nil {
+		params = t.Type.Interface.TypeParams
+	}
+
+	if len(params) > 0 {
+		td.TypeParams = typeParamIdents(params)
+		td.Instantiate = t.Type.Transform
+		td.Bounds = typeParamBounds(params)
+	}
+
+	return td
+}
+
+func (g *Global) Transform(scope ast.ScopeLike) *ast.Global {
+	global := &ast.Global{
+		Variable: &ast.Variable{
+			Ident:   g.Declarator.Ident,
+			Type:    g.Declarator.Type.Transform(scope),
+			IsConst: g.Const,
+			Pos:     g.Pos,
+		},
+		Exported: g.Export,
+		Scope:    scope,
+		Pos:      g.Pos,
+	}
+
+	if g.Expr != nil {
+		global.Expr = g.Expr.Transform(scope)
+	}
+
+	return global
 }
 
 func (f *Function) Transform(scope ast.ScopeLike) *ast.Function {
+	fn := f.transform(scope)
+
+	// the body of a generic function is transformed again for every instance
+	if len(f.TypeParams) > 0 {
+		fn.TypeParams = typeParamIdents(f.TypeParams)
+		fn.Instantiate = f.transform
+		fn.Bounds = typeParamBounds(f.TypeParams)
+	}
+
+	return fn
+}
+
+func (f *Function) transform(scope ast.ScopeLike) *ast.Function {
 	childScope := ast.NewScopeFromParent(scope)
 
 	fn := &ast.Function{
@@ -44,11 +106,18 @@ func (f *Function) Transform(scope ast.ScopeLike) *ast.Function {
 		Variadic:    f.Variadic,
 		Body:        []ast.StatementLike{},
 		OnlyDeclare: f.OnlyDeclare,
+		Exported:    f.Export,
 
 		Scope: childScope,
 		Pos:   f.Pos,
 	}
 
+	// a method is declared against the type alias before its name, e.g. Node.len
+	if f.Method != "" {
+		fn.Name = f.Declarator.Ident + "." + f.Method
+		fn.Receiver = f.Declarator.Ident
+	}
+
 	fn.ReturnType = f.Declarator.Type.Transform(fn)
 
 	if f.Params != nil {
@@ -85,12 +154,18 @@ func (s *Stmt) Transform(scope ast.ScopeLike) []ast.StatementLike {
 		return []ast.StatementLike{s.IfStmt.Transform(scope)}
 	case s.WhileStmt != nil:
 		return []ast.StatementLike{s.WhileStmt.Transform(scope)}
+	case s.DoWhileStmt != nil:
+		return []ast.StatementLike{s.DoWhileStmt.Transform(scope)}
 	case s.ForStmt != nil:
 		return []ast.StatementLike{s.ForStmt.Transform(scope)}
 	case s.ContinueStmt != nil:
 		return []ast.StatementLike{s.ContinueStmt.Transform(scope)}
 	case s.BreakStmt != nil:
 		return []ast.StatementLike{s.BreakStmt.Transform(scope)}
+	case s.SwitchStmt != nil:
+		return []ast.StatementLike{s.SwitchStmt.Transform(scope)}
+	case s.MatchStmt != nil:
+		return []ast.StatementLike{s.MatchStmt.Transform(scope)}
 	default:
 		panic("unknown statement")
 	}
@@ -105,13 +180,39 @@ func (a *ExprStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 }
 
 func (a *DeclStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
+	if len(a.Rest) > 0 {
+		return a.destructure(scope)
+	}
+
 	ds := &ast.DeclStmt{
-		Ident: a.Declarator.Ident,
-		Type:  a.Declarator.Type.Transform(scope),
+		Ident:   a.Declarator.Ident,
+		Type:    a.Declarator.Type.Transform(scope),
+		IsConst: a.Const,
+		Scope:   scope,
+		Pos:     a.Pos,
+	}
+
+	if a.Expr != nil {
+		ds.Expr = a.Expr.Transform(scope)
+	}
+
+	return ds
+}
+
+func (a *DeclStmt) destructure(scope ast.ScopeLike) ast.StatementLike {
+	ds := &ast.DestructureStmt{
 		Scope: scope,
 		Pos:   a.Pos,
 	}
 
+	for _, d := range append([]*Declarator{a.Declarator}, a.Rest...) {
+		ds.Vars = append(ds.Vars, &ast.Variable{
+			Ident: d.Ident,
+			Type:  d.Type.Transform(scope),
+			Pos:   d.Pos,
+		})
+	}
+
 	if a.Expr != nil {
 		ds.Expr = a.Expr.Transform(scope)
 	}
@@ -122,6 +223,7 @@ func (a *DeclStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 func (a *AssignStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 	return &ast.AssignStmt{
 		Left:  a.Left.Transform(scope),
+		Op:    a.Op,
 		Right: a.Right.Transform(scope),
 		Scope: scope,
 		Pos:   a.Pos,
@@ -131,8 +233,10 @@ func (a *AssignStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 func (r *ReturnStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 	var expr ast.ExpressionLike
 
-	if r.Expr != nil {
-		expr = r.Expr.Transform(scope)
+	if len(r.Exprs) == 1 {
+		expr = r.Exprs[0].Transform(scope)
+	} else if len(r.Exprs) > 1 {
+		expr = transformTuple(scope, r.Pos, r.Exprs)
 	}
 
 	return &ast.ReturnStmt{
@@ -144,6 +248,7 @@ func (r *ReturnStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 
 func (r *ContinueStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 	return &ast.ContinueStmt{
+		Label: r.Ident,
 		Scope: scope,
 		Pos:   r.Pos,
 	}
@@ -151,6 +256,7 @@ func (r *ContinueStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 
 func (r *BreakStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 	return &ast.BreakStmt{
+		Label: r.Ident,
 		Scope: scope,
 		Pos:   r.Pos,
 	}
@@ -190,6 +296,7 @@ func (i *IfStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 
 func (w *WhileStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 	return &ast.WhileStmt{
+		Label:     w.Label,
 		Condition: w.Condition.Transform(scope),
 		Body:      w.Body.Transform(scope),
 		Scope:     scope,
@@ -197,6 +304,16 @@ func (w *WhileStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 	}
 }
 
+func (d *DoWhileStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
+	return &ast.DoWhileStmt{
+		Label:     d.Label,
+		Body:      d.Body.Transform(scope),
+		Condition: d.Condition.Transform(scope),
+		Scope:     scope,
+		Pos:       d.Pos,
+	}
+}
+
 func (f *ForStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 	var post ast.StatementLike
 	if f.AssignPost != nil {
@@ -205,8 +322,16 @@ func (f *ForStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 		post = f.ExprPost.Transform(scope)
 	}
 
+	var init ast.StatementLike
+	if f.Init != nil {
+		init = f.Init.Transform(scope)
+	} else if f.ExprInit != nil {
+		init = f.ExprInit.Transform(scope)
+	}
+
 	return &ast.ForStmt{
-		Init:      f.Init.Transform(scope),
+		Label:     f.Label,
+		Init:      init,
 		Condition: f.Condition.Transform(scope),
 		Post:      post,
 		Body:      f.Body.Transform(scope),
@@ -215,8 +340,83 @@ func (f *ForStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
 	}
 }
 
+func (s *SwitchStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
+	cases := make([]*ast.SwitchCase, 0, len(s.Cases))
+
+	for _, c := range s.Cases {
+		sc := &ast.SwitchCase{
+			IsDefault: c.Default,
+			Body:      []ast.StatementLike{},
+			Pos:       c.Pos,
+		}
+
+		if c.Value != nil {
+			sc.Value = c.Value.Transform(scope)
+		}
+
+		for _, stmt := range c.Stmts {
+			sc.Body = append(sc.Body, stmt.Transform(scope)...)
+		}
+
+		cases = append(cases, sc)
+	}
+
+	return &ast.SwitchStmt{
+		Expr:  s.Expr.Transform(scope),
+		Cases: cases,
+		Scope: scope,
+		Pos:   s.Pos,
+	}
+}
+
+func (m *MatchStmt) Transform(scope ast.ScopeLike) ast.StatementLike {
+	arms := make([]*ast.MatchArm, 0, len(m.Arms))
+
+	for _, a := range m.Arms {
+		// every arm has its own scope for the binding
+		body := &ast.Block{
+			Stmts: []ast.StatementLike{},
+			Scope: ast.NewScopeFromParent(scope),
+			Pos:   a.Pos,
+		}
+
+		for _, stmt := range a.Stmts {
+			body.Stmts = append(body.Stmts, stmt.Transform(body)...)
+		}
+
+		arms = append(arms, &ast.MatchArm{
+			Variant:   a.Variant,
+			Binding:   a.Binding,
+			IsDefault: a.Default,
+			Body:      body,
+			Pos:       a.Pos,
+		})
+	}
+
+	return &ast.MatchStmt{
+		Expr:  m.Expr.Transform(scope),
+		Arms:  arms,
+		Scope: scope,
+		Pos:   m.Pos,
+	}
+}
+
 func (e *Expr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
-	return e.LogicalExpr.Transform(scope)
+	return e.ConditionalExpr.Transform(scope)
+}
+
+func (ce *ConditionalExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
+	if ce.Then == nil {
+		return ce.Condition.Transform(scope)
+	}
+
+	return &ast.ConditionalOp{
+		Condition: ce.Condition.Transform(scope),
+		Then:      ce.Then.Transform(scope),
+		Else:      ce.Else.Transform(scope),
+		Scope:     scope,
+		Pos:       ce.Pos,
+	}
 }
 
 func (le *LogicalExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
@@ -233,6 +433,20 @@ func (le *LogicalExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
 	}
 }
 
+func (la *LogicalAndExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
+	if la.Op == "" {
+		return la.Left.Transform(scope)
+	}
+
+	return &ast.BinaryOp{
+		Left:  la.Left.Transform(scope),
+		Op:    la.Op,
+		Right: la.Right.Transform(scope),
+		Scope: scope,
+		Pos:   la.Pos,
+	}
+}
+
 func (io *InclusiveOrExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
 	if io.Op == "" {
 		return io.Left.Transform(scope)
@@ -405,13 +619,22 @@ func (ae *AccessorExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
 			deref = true
 		}
 
+		field := tail.Field
+		if tail.Element != "" {
+			field = strings.TrimPrefix(tail.Element, ".")
+		}
+
 		head = &ast.AccessorOp{
 			Expr:        head,
-			Field:       tail.Field,
+			Field:       field,
 			Dereference: deref,
 			Scope:       scope,
 			Pos:         tail.Pos,
 		}
+
+		if tail.Call != nil {
+			head = tail.Call.Transform(scope, head)
+		}
 	}
 
 	return head
@@ -421,6 +644,11 @@ func (ie *IndexExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
 	head := ie.Head.Transform(scope)
 
 	for _, tail := range ie.Tail {
+		if tail.Call != nil {
+			head = tail.Call.Transform(scope, head)
+			continue
+		}
+
 		head = &ast.IndexOp{
 			Expr:      head,
 			IndexExpr: tail.Index.Transform(scope),
@@ -434,6 +662,8 @@ func (ie *IndexExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
 
 func (ue *UnaryExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
 	switch {
+	case ue.LambdaExpr != nil:
+		return ue.LambdaExpr.Transform(scope)
 	case ue.FnCallExpr != nil:
 		return ue.FnCallExpr.Transform(scope)
 	case ue.PrimaryExpr != nil:
@@ -474,10 +704,69 @@ func (fce *FnCallExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
 	}
 
 	return &ast.FnCallOp{
-		Ident: fce.Ident,
+		Ident:    fce.Ident,
+		TypeArgs: transformTypes(scope, fce.TypeArgs),
+		Args:     args,
+		Scope:    scope,
+		Pos:      fce.Pos,
+	}
+}
+
+func (le *LambdaExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
+	captures := make([]*ast.Capture, 0, len(le.Captures))
+	for _, c := range le.Captures {
+		captures = append(captures, &ast.Capture{
+			Ident:     c.Ident,
+			Reference: c.Reference,
+			Pos:       c.Pos,
+		})
+	}
+
+	return &ast.LambdaOp{
+		Fn:        le.transform(scope),
+		Transform: le.transform,
+		Captures:  captures,
+		Scope:     scope,
+		Pos:       le.Pos,
+	}
+}
+
+// transform returns the lambda as a function, its name is given when it is generated.
+func (le *LambdaExpr) transform(scope ast.ScopeLike) *ast.Function {
+	fn := &ast.Function{
+		Params: []*ast.Variable{},
+		Body:   []ast.StatementLike{},
+		Scope:  ast.NewScopeFromParent(scope),
+		Pos:    le.Pos,
+	}
+
+	fn.ReturnType = le.ReturnType.Transform(fn)
+
+	for _, param := range le.Params {
+		fn.Params = append(fn.Params, &ast.Variable{
+			Ident:   param.Ident,
+			Type:    param.Type.Transform(fn),
+			IsParam: true,
+		})
+	}
+
+	fn.Body = append(fn.Body, le.Body.Transform(fn))
+
+	return fn
+}
+
+func (ca *CallArgs) Transform(scope ast.ScopeLike, callee ast.ExpressionLike) ast.ExpressionLike {
+	args := make([]ast.ExpressionLike, len(ca.Args))
+
+	for i, arg := range ca.Args {
+		args[i] = arg.Transform(scope)
+	}
+
+	return &ast.FnCallOp{
+		Expr:  callee,
 		Args:  args,
 		Scope: scope,
-		Pos:   fce.Pos,
+		Pos:   ca.Pos,
 	}
 }
 
@@ -497,6 +786,10 @@ func (pe *PrimaryExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
 			Scope: scope,
 			Pos:   pe.Pos,
 		}
+	case pe.Struct != nil:
+		return pe.Struct.Transform(scope)
+	case pe.Array != nil:
+		return pe.Array.Transform(scope)
 	case pe.Null != "":
 		return &ast.ConstantNullOp{
 			Constant: pe.Null,
@@ -517,31 +810,14 @@ func (pe *PrimaryExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
 			Pos:      pe.Pos,
 		}
 	case pe.String != nil:
-		sb := strings.Builder{}
-		for _, el := range pe.String.Parts {
-			if strings.HasPrefix(el, "\\") {
-				switch el[1:] {
-				case "n":
-					sb.WriteByte('\n')
-				case "r":
-					sb.WriteByte('\r')
-				case "t":
-					sb.WriteByte('\t')
-				case `"`:
-					sb.WriteByte('"')
-				default:
-					sb.WriteString(el)
-				}
-			} else {
-				sb.WriteString(el)
-			}
-		}
-
+		// escape sequences are kept as written and decoded when the literal is generated
 		return &ast.ConstantStringOp{
-			Constant: sb.String(),
+			Constant: strings.Join(pe.String.Parts, ""),
 			Scope:    scope,
 			Pos:      pe.Pos,
 		}
+	case pe.Tuple != nil:
+		return transformTuple(scope, pe.Pos, pe.Tuple)
 	case pe.Expr != nil:
 		return pe.Expr.Transform(scope)
 	default:
@@ -549,11 +825,106 @@ func (pe *PrimaryExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
 	}
 }
 
+func (se *StructExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
+	fields := make([]*ast.StructLiteralField, 0, len(se.StructFields))
+
+	for _, f := range se.StructFields {
+		fields = append(fields, &ast.StructLiteralField{
+			Ident: f.Field,
+			Expr:  f.Expr.Transform(scope),
+			Pos:   f.Pos,
+		})
+	}
+
+	return &ast.StructLiteralOp{
+		Type:   aliasType(scope, se.Pos, se.Alias, se.TypeArgs),
+		Fields: fields,
+		Scope:  scope,
+		Pos:    se.Pos,
+	}
+}
+
+func (ae *ArrayExpr) Transform(scope ast.ScopeLike) ast.ExpressionLike {
+	elems := make([]ast.ExpressionLike, 0, len(ae.Elems))
+
+	for _, e := range ae.Elems {
+		elems = append(elems, e.Transform(scope))
+	}
+
+	return &ast.ArrayLiteralOp{
+		Elems: elems,
+		Scope: scope,
+		Pos:   ae.Pos,
+	}
+}
+
 func (t *Type) Transform(scope ast.ScopeLike) *ast.Type {
 	var typ *ast.Type
 
 	if t.Basic != "" {
 		typ = ast.NewTypeBasic(scope, t.Pos, ast.BasicType(t.Basic))
+	} else if t.Union != nil {
+		fields := make([]*ast.StructField, 0, len(t.Union.Fields))
+		for _, f := range t.Union.Fields {
+			fields = append(fields, &ast.StructField{
+				Ident: f.Ident,
+				Type:  f.Type.Transform(scope),
+			})
+		}
+
+		typ = ast.NewTypeUnion(scope, t.Pos, t.Union.Tagged, fields...)
+	} else if t.Enum != nil {
+		members := make([]*ast.EnumMember, 0, len(t.Enum.Members))
+
+		// like in C, a member without a value is one more than the previous member
+		next := int64(0)
+		for _, m := range t.Enum.Members {
+			if m.Value != nil {
+				next = int64(*m.Value)
+			}
+
+			members = append(members, &ast.EnumMember{
+				Ident: m.Ident,
+				Value: next,
+				Pos:   m.Pos,
+			})
+
+			next++
+		}
+
+		typ = ast.NewTypeEnum(scope, t.Pos, members...)
+	} else if t.Func != nil {
+		params := make([]*ast.Type, 0, len(t.Func.Params))
+		for _, p := range t.Func.Params {
+			params = append(params, p.Transform(scope))
+		}
+
+		if t.Func.Closure {
+			typ = ast.NewTypeClosure(scope, t.Pos, params, t.Func.Variadic, t.Func.ReturnType.Transform(scope))
+		} else {
+			typ = ast.NewTypeFunc(scope, t.Pos, params, t.Func.Variadic, t.Func.ReturnType.Transform(scope))
+		}
+	} else if t.Tuple != nil {
+		typ = ast.NewTypeTuple(scope, t.Pos, transformTypes(scope, t.Tuple)...)
+	} else if t.Interface != nil {
+		methods := make([]*ast.InterfaceMethod, 0, len(t.Interface.Methods))
+		for _, m := range t.Interface.Methods {
+			params := make([]*ast.Type, 0, len(m.Params))
+			for _, p := range m.Params {
+				params = append(params, p.Type.Transform(scope))
+			}
+
+			methods = append(methods, &ast.InterfaceMethod{
+				Ident: m.Ident,
+				Func: &ast.FuncType{
+					Params:     params,
+					ReturnType: m.ReturnType.Transform(scope),
+				},
+				Pos: m.Pos,
+			})
+		}
+
+		typ = ast.NewTypeInterface(scope, t.Pos, methods...)
 	} else if t.Struct != nil {
 		fields := make([]*ast.StructField, 0, len(t.Struct.Fields))
 		for _, f := range t.Struct.Fields {
@@ -565,16 +936,89 @@ func (t *Type) Transform(scope ast.ScopeLike) *ast.Type {
 
 		typ = ast.NewTypeStruct(scope, t.Pos, fields...)
 	} else if t.Alias != "" {
-		typ = ast.NewTypeAlias(scope, t.Pos, t.Alias)
+		typ = aliasType(scope, t.Pos, t.Alias, t.TypeArgs)
 	}
 
 	for range t.Pointers {
 		typ = typ.NewPointer()
 	}
 
-	for _, l := range t.Lengths {
-		typ = typ.NewArray(l)
+	// [2][3]i64 is an array of 2 arrays of 3 elements, so the innermost length is the last one
+	for i := len(t.Lengths) - 1; i >= 0; i-- {
+		typ = typ.NewArrayExpr(t.Lengths[i].Transform(scope))
 	}
 
 	return typ
 }
+
+// aliasType returns the type named by alias, which is the type argument if alias is a type parameter.
+func aliasType(scope ast.ScopeLike, pos lexer.Position, alias string, typeArgs []*Type) *ast.Type {
+	if len(typeArgs) == 0 {
+		if arg := ast.TypeArgument(scope, alias); arg != nil {
+			return arg
+		}
+	}
+
+	return ast.NewTypeAlias(scope, pos, alias, transformTypes(scope, typeArgs)...)
+}
+
+func transformTypes(scope ast.ScopeLike, types []*Type) []*ast.Type {
+	if len(types) == 0 {
+		return nil
+	}
+
+	result := make([]*ast.Type, 0, len(types))
+	for _, t := range types {
+		result = append(result, t.Transform(scope))
+	}
+
+	return result
+}
+
+func typeParamIdents(params []*TypeParam) []string {
+	idents := make([]string, 0, len(params))
+	for _, p := range params {
+		idents = append(idents, p.Ident)
+	}
+
+	return idents
+}
+
+// typeParamBounds returns the transformation of the bounds, nil if no parameter has one.
+// The bounds are transformed in the scope of an instance, so they can refer to the type arguments.
+func typeParamBounds(params []*TypeParam) func(ast.ScopeLike) []*ast.Type {
+	bounded := false
+	for _, p := range params {
+		bounded = bounded || p.Bound != nil
+	}
+
+	if !bounded {
+		return nil
+	}
+
+	return func(scope ast.ScopeLike) []*ast.Type {
+		bounds := make([]*ast.Type, 0, len(params))
+		for _, p := range params {
+			if p.Bound == nil {
+				bounds = append(bounds, nil)
+			} else {
+				bounds = append(bounds, p.Bound.Transform(scope))
+			}
+		}
+
+		return bounds
+	}
+}
+
+func transformTuple(scope ast.ScopeLike, pos lexer.Position, exprs []*Expr) ast.ExpressionLike {
+	elems := make([]ast.ExpressionLike, 0, len(exprs))
+	for _, e := range exprs {
+		elems = append(elems, e.Transform(scope))
+	}
+
+	return &ast.TupleLiteralOp{
+		Elems: elems,
+		Scope: scope,
+		Pos:   pos,
+	}
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -18,8 +19,19 @@ func WithPos(cause error, file *File, pos lexer.Position) error {
 	return &withPos{cause, file, pos}
 }
 
+// FileOf returns the file of the outermost positioned error in the chain of err, or nil if there is none.
+func FileOf(err error) *File {
+	var w *withPos
+	if errors.As(err, &w) {
+		return w.File
+	}
+
+	return nil
+}
+
 func (w *withPos) Message() string {
-	message := ""
+	// name the file, errors can come from any file of a program
+	message := fmt.Sprintf("\n%s:%d:%d", w.File.Name, w.Pos.Line, w.Pos.Column)
 
 	// start character position of the line where the error occurred
 	start := 0